@@ -0,0 +1,212 @@
+package arena
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+const defaultChunkSize = 64 * 1024
+
+// Arena hands out request-scoped objects from large chunks and frees them all
+// at once with Reset. It is not safe for concurrent use.
+//
+// Pointer-free values live in plain byte chunks the GC never scans. A pointer
+// stored there would be invisible to the GC, so New and MakeSlice refuse types
+// that contain pointers unless the arena was created with AllowPointers; those
+// types then get their own typed chunks, which the GC scans as usual.
+//
+// After Reset every value handed out before is reused memory: keeping a
+// pointer into the arena past Reset is a use-after-free.
+type Arena struct {
+	chunkSize     int
+	allowPointers bool
+
+	chunks [][]byte // noscan chunks, reused after Reset
+	idx    int      // current chunk
+	off    int      // next free byte in chunks[idx]
+
+	slabs map[reflect.Type]resetter // typed chunks for pointer-containing types
+}
+
+type Option func(*Arena)
+
+// WithChunkSize sets the size of each chunk. Larger values mean fewer
+// allocations per batch, at the cost of memory retained between batches.
+func WithChunkSize(n int) Option {
+	return func(a *Arena) { a.chunkSize = n }
+}
+
+// AllowPointers lets New and MakeSlice accept types that contain pointers,
+// strings, slices, maps or interfaces. Such values are kept in GC-scanned
+// typed chunks, so they stay correct but cost GC scan time.
+func AllowPointers() Option {
+	return func(a *Arena) { a.allowPointers = true }
+}
+
+func NewArena(opts ...Option) *Arena {
+	a := &Arena{chunkSize: defaultChunkSize}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// New returns a pointer to a zeroed T allocated in the arena.
+func New[T any](a *Arena) *T {
+	if hasPointers(reflect.TypeFor[T]()) {
+		s := slabFor[T](a)
+		return &s.alloc(1, a.chunkSize)[0]
+	}
+	var zero T
+	p := a.alloc(int(unsafe.Sizeof(zero)), int(unsafe.Alignof(zero)))
+	return (*T)(p)
+}
+
+// MakeSlice returns a zeroed []T of length n and capacity n allocated in the arena.
+// Appending beyond n reallocates on the Go heap as usual.
+func MakeSlice[T any](a *Arena, n int) []T {
+	if n == 0 {
+		return []T{}
+	}
+	if hasPointers(reflect.TypeFor[T]()) {
+		return slabFor[T](a).alloc(n, a.chunkSize)
+	}
+	var zero T
+	p := a.alloc(int(unsafe.Sizeof(zero))*n, int(unsafe.Alignof(zero)))
+	return unsafe.Slice((*T)(p), n)
+}
+
+// String copies b into the arena and returns it as a string. The string is
+// valid until Reset.
+func String(a *Arena, b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	dst := MakeSlice[byte](a, len(b))
+	copy(dst, b)
+	return unsafe.String(&dst[0], len(dst))
+}
+
+// Reset releases everything allocated from the arena. Chunks are kept and
+// reused by the next batch.
+func (a *Arena) Reset() {
+	a.idx, a.off = 0, 0
+	for _, s := range a.slabs {
+		s.reset()
+	}
+}
+
+func (a *Arena) alloc(size, align int) unsafe.Pointer {
+	if size == 0 {
+		return unsafe.Pointer(&zeroBase)
+	}
+	for {
+		for ; a.idx < len(a.chunks); a.idx, a.off = a.idx+1, 0 {
+			chunk := a.chunks[a.idx]
+			off := (a.off + align - 1) &^ (align - 1)
+			if off+size <= len(chunk) {
+				a.off = off + size
+				mem := chunk[off : off+size]
+				clear(mem)
+				return unsafe.Pointer(&mem[0])
+			}
+		}
+		a.chunks = append(a.chunks, newChunk(max(a.chunkSize, size)))
+		a.idx = len(a.chunks) - 1
+	}
+}
+
+// newChunk allocates pointer-free memory aligned to 8 bytes.
+func newChunk(size int) []byte {
+	words := make([]uint64, (size+7)/8)
+	return unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)
+}
+
+var zeroBase uint64
+
+// --- Section: Typed chunks for pointer-containing types ---
+
+type resetter interface{ reset() }
+
+type slab[T any] struct {
+	chunks [][]T
+	idx    int
+	used   int
+}
+
+func slabFor[T any](a *Arena) *slab[T] {
+	t := reflect.TypeFor[T]()
+	if !a.allowPointers {
+		panic(fmt.Sprintf("arena: %v contains pointers; create the arena with AllowPointers to store it", t))
+	}
+	if s, ok := a.slabs[t]; ok {
+		return s.(*slab[T])
+	}
+	if a.slabs == nil {
+		a.slabs = make(map[reflect.Type]resetter)
+	}
+	s := &slab[T]{}
+	a.slabs[t] = s
+	return s
+}
+
+func (s *slab[T]) alloc(n, chunkBytes int) []T {
+	for {
+		for ; s.idx < len(s.chunks); s.idx, s.used = s.idx+1, 0 {
+			chunk := s.chunks[s.idx]
+			if s.used+n <= len(chunk) {
+				out := chunk[s.used : s.used+n : s.used+n]
+				s.used += n
+				return out
+			}
+		}
+		var zero T
+		per := max(chunkBytes/max(int(unsafe.Sizeof(zero)), 1), n)
+		s.chunks = append(s.chunks, make([]T, per))
+		s.idx = len(s.chunks) - 1
+	}
+}
+
+// reset zeroes the used part of every chunk so the GC does not keep objects
+// reachable from stale values, then starts over from the first chunk.
+func (s *slab[T]) reset() {
+	for i := 0; i < s.idx && i < len(s.chunks); i++ {
+		clear(s.chunks[i])
+	}
+	if s.idx < len(s.chunks) {
+		clear(s.chunks[s.idx][:s.used])
+	}
+	s.idx, s.used = 0, 0
+}
+
+// --- Section: Pointer detection ---
+
+var pointerCache sync.Map // reflect.Type -> bool
+
+func hasPointers(t reflect.Type) bool {
+	if v, ok := pointerCache.Load(t); ok {
+		return v.(bool)
+	}
+	v := typeHasPointers(t)
+	pointerCache.Store(t, v)
+	return v
+}
+
+func typeHasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.String, reflect.Slice,
+		reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	case reflect.Array:
+		return t.Len() > 0 && typeHasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if typeHasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package arena
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// Obj matches the pointer-free object of panic-deffer-recover.
+type Obj struct {
+	A int
+	B int
+	C [256]byte
+}
+
+type LogRecord struct {
+	TS  int64
+	Lev string
+	App string
+	Msg string
+}
+
+const batchSize = 200
+
+var (
+	objSink   *Obj
+	batchSink []*LogRecord
+	arenaSink []LogRecord
+	testBatch = makeBatch()
+)
+
+// makeBatch builds a batch of "ts|lev|app|msg" lines, one record per line.
+func makeBatch() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < batchSize; i++ {
+		fmt.Fprintf(&buf, "%d|info|gateway|request %d served\n", 123456789+i, i)
+	}
+	return buf.Bytes()
+}
+
+// parseLine splits one line into its four fields without allocating.
+func parseLine(line []byte) (ts int64, lev, app, msg []byte) {
+	f1 := bytes.IndexByte(line, '|')
+	f2 := f1 + 1 + bytes.IndexByte(line[f1+1:], '|')
+	f3 := f2 + 1 + bytes.IndexByte(line[f2+1:], '|')
+	for _, c := range line[:f1] {
+		ts = ts*10 + int64(c-'0')
+	}
+	return ts, line[f1+1 : f2], line[f2+1 : f3], line[f3+1:]
+}
+
+func parseBatchHeap(src []byte) []*LogRecord {
+	out := make([]*LogRecord, 0, batchSize)
+	for len(src) > 0 {
+		end := bytes.IndexByte(src, '\n')
+		ts, lev, app, msg := parseLine(src[:end])
+		out = append(out, &LogRecord{TS: ts, Lev: string(lev), App: string(app), Msg: string(msg)})
+		src = src[end+1:]
+	}
+	return out
+}
+
+func parseBatchArena(a *Arena, src []byte) []LogRecord {
+	out := MakeSlice[LogRecord](a, bytes.Count(src, []byte{'\n'}))
+	for i := range out {
+		end := bytes.IndexByte(src, '\n')
+		ts, lev, app, msg := parseLine(src[:end])
+		out[i] = LogRecord{TS: ts, Lev: String(a, lev), App: String(a, app), Msg: String(a, msg)}
+		src = src[end+1:]
+	}
+	return out
+}
+
+// --- Section: Tests ---
+
+func TestNewZeroedAfterReset(t *testing.T) {
+	a := NewArena(WithChunkSize(1024))
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ { // 100*272 bytes spans many 1 KB chunks
+			o := New[Obj](a)
+			if o.A != 0 || o.B != 0 || o.C != [256]byte{} {
+				t.Fatalf("round %d: object %d not zeroed", round, i)
+			}
+			if uintptr(unsafe.Pointer(o))%unsafe.Alignof(*o) != 0 {
+				t.Fatalf("object %d misaligned", i)
+			}
+			o.A, o.B, o.C[0] = i, -i, 0xff
+		}
+		a.Reset()
+	}
+}
+
+func TestMakeSliceLargerThanChunk(t *testing.T) {
+	a := NewArena(WithChunkSize(64))
+	small := MakeSlice[uint32](a, 3)
+	big := MakeSlice[uint64](a, 1000)
+	if len(big) != 1000 || cap(big) != 1000 {
+		t.Fatalf("len/cap = %d/%d, want 1000", len(big), cap(big))
+	}
+	for i := range big {
+		big[i] = uint64(i)
+	}
+	small[0], small[1], small[2] = 1, 2, 3
+	if big[0] != 0 || big[999] != 999 {
+		t.Fatalf("slices overlap: %v %v", small, big[:3])
+	}
+}
+
+func TestRefusesPointersByDefault(t *testing.T) {
+	a := NewArena()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("New[LogRecord] on a pointer-free arena did not panic")
+		}
+	}()
+	New[LogRecord](a)
+}
+
+func TestAllowPointers(t *testing.T) {
+	a := NewArena(AllowPointers(), WithChunkSize(4096))
+	for round := 0; round < 2; round++ {
+		recs := parseBatchArena(a, testBatch)
+		want := parseBatchHeap(testBatch)
+		if len(recs) != len(want) {
+			t.Fatalf("got %d records, want %d", len(recs), len(want))
+		}
+		for i := range want {
+			if recs[i] != *want[i] {
+				t.Fatalf("record %d: got %+v, want %+v", i, recs[i], *want[i])
+			}
+		}
+		p := New[*Obj](a)
+		if *p != nil {
+			t.Fatalf("round %d: pointer slot not zeroed after Reset", round)
+		}
+		*p = &Obj{}
+		a.Reset()
+	}
+}
+
+func TestHasPointers(t *testing.T) {
+	cases := []struct {
+		v    any
+		want bool
+	}{
+		{Obj{}, false},
+		{[4]int64{}, false},
+		{[0]*int{}, false},
+		{LogRecord{}, true},
+		{struct{ X [2]*int }{}, true},
+		{[]byte(nil), true},
+	}
+	for _, c := range cases {
+		if got := typeHasPointers(reflect.TypeOf(c.v)); got != c.want {
+			t.Errorf("%T: hasPointers = %v, want %v", c.v, got, c.want)
+		}
+	}
+}
+
+// --- Section: Pointer-free objects ---
+
+func BenchmarkNewHeap(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		objSink = &Obj{A: i}
+	}
+}
+
+func BenchmarkNewArena(b *testing.B) {
+	a := NewArena()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		o := New[Obj](a)
+		o.A = i
+		objSink = o
+		if i%batchSize == batchSize-1 {
+			a.Reset()
+		}
+	}
+}
+
+// --- Section: Parsed log batch ---
+
+func BenchmarkLogBatchHeap(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(testBatch)))
+
+	for i := 0; i < b.N; i++ {
+		batchSink = parseBatchHeap(testBatch)
+	}
+}
+
+func BenchmarkLogBatchArena(b *testing.B) {
+	a := NewArena(AllowPointers())
+	b.ReportAllocs()
+	b.SetBytes(int64(len(testBatch)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		a.Reset()
+		arenaSink = parseBatchArena(a, testBatch)
+	}
+}
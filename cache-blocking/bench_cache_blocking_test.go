@@ -0,0 +1,153 @@
+package cacheblocking
+
+import (
+	"fmt"
+	"testing"
+)
+
+const (
+	matN     = 512  // 512x512 float64 = 2 MB per matrix, larger than L2 on most cores
+	stencilN = 2048 // 2048x2048 float64 = 32 MB per grid
+)
+
+var tileSizes = []int{16, 32, 64, 128}
+
+func makeMatrix(n, seed int) []float64 {
+	m := make([]float64, n*n)
+	for i := range m {
+		// small integers keep every sum exact, so variants compare with ==
+		m[i] = float64((i*seed)%7 - 3)
+	}
+	return m
+}
+
+func assertEqual(t *testing.T, name string, want, got []float64) {
+	t.Helper()
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("%s: mismatch at %d: want %v, got %v", name, i, want[i], got[i])
+		}
+	}
+}
+
+// --- Section: Correctness ---
+
+func TestMatMulVariantsMatchNaive(t *testing.T) {
+	// 100 is not a multiple of any tile size, so partial edge tiles are covered
+	for _, n := range []int{1, 7, 64, 100} {
+		a, b := makeMatrix(n, 3), makeMatrix(n, 5)
+		want := make([]float64, n*n)
+		MatMulNaive(a, b, want, n)
+
+		got := make([]float64, n*n)
+		MatMulReordered(a, b, got, n)
+		assertEqual(t, fmt.Sprintf("reordered n=%d", n), want, got)
+
+		for _, tile := range append(tileSizes, 0, 3, AutoTile()) {
+			MatMulTiled(a, b, got, n, tile)
+			assertEqual(t, fmt.Sprintf("tiled n=%d tile=%d", n, tile), want, got)
+		}
+	}
+}
+
+func TestStencilVariantsMatchNaive(t *testing.T) {
+	for _, n := range []int{3, 17, 100} {
+		src := makeMatrix(n, 11)
+		want := make([]float64, n*n)
+		StencilNaive(src, want, n)
+
+		got := make([]float64, n*n)
+		StencilReordered(src, got, n)
+		assertEqual(t, fmt.Sprintf("reordered n=%d", n), want, got)
+
+		for _, tile := range append(tileSizes, 0, 3, AutoTile()) {
+			StencilTiled(src, got, n, tile)
+			assertEqual(t, fmt.Sprintf("tiled n=%d tile=%d", n, tile), want, got)
+		}
+	}
+}
+
+func TestTileForCache(t *testing.T) {
+	cases := map[int]int{
+		32 * 1024:   32, // sqrt(32K/24) = 36 -> 32
+		48 * 1024:   40, // sqrt(48K/24) = 45 -> 40
+		1024 * 1024: 208,
+		100:         8,
+	}
+	for cache, want := range cases {
+		if got := TileForCache(cache); got != want {
+			t.Errorf("TileForCache(%d) = %d, want %d", cache, got, want)
+		}
+	}
+}
+
+// --- Section: Matrix multiply ---
+
+func BenchmarkMatMulNaive(b *testing.B) {
+	x, y, c := makeMatrix(matN, 3), makeMatrix(matN, 5), make([]float64, matN*matN)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		MatMulNaive(x, y, c, matN)
+	}
+}
+
+func BenchmarkMatMulReordered(b *testing.B) {
+	x, y, c := makeMatrix(matN, 3), makeMatrix(matN, 5), make([]float64, matN*matN)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		MatMulReordered(x, y, c, matN)
+	}
+}
+
+func BenchmarkMatMulTiled(b *testing.B) {
+	x, y, c := makeMatrix(matN, 3), makeMatrix(matN, 5), make([]float64, matN*matN)
+	b.Logf("auto tile: %d", AutoTile())
+
+	for _, tile := range append(tileSizes, AutoTile()) {
+		b.Run(fmt.Sprintf("tile=%d", tile), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				MatMulTiled(x, y, c, matN, tile)
+			}
+		})
+	}
+}
+
+// --- Section: Stencil ---
+
+func BenchmarkStencilNaive(b *testing.B) {
+	src, dst := makeMatrix(stencilN, 3), make([]float64, stencilN*stencilN)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		StencilNaive(src, dst, stencilN)
+	}
+}
+
+func BenchmarkStencilReordered(b *testing.B) {
+	src, dst := makeMatrix(stencilN, 3), make([]float64, stencilN*stencilN)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		StencilReordered(src, dst, stencilN)
+	}
+}
+
+func BenchmarkStencilTiled(b *testing.B) {
+	src, dst := makeMatrix(stencilN, 3), make([]float64, stencilN*stencilN)
+
+	for _, tile := range append(tileSizes, AutoTile()) {
+		b.Run(fmt.Sprintf("tile=%d", tile), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				StencilTiled(src, dst, stencilN, tile)
+			}
+		})
+	}
+}
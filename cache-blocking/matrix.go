@@ -0,0 +1,63 @@
+package cacheblocking
+
+// All matrices are square n*n, row-major, stored in a flat []float64.
+// Every kernel computes c = a*b and overwrites c.
+
+// MatMulNaive is the textbook i-j-k loop. The inner loop walks b by column,
+// so every iteration touches a new cache line of b.
+func MatMulNaive(a, b, c []float64, n int) {
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			var s float64
+			for k := 0; k < n; k++ {
+				s += a[i*n+k] * b[k*n+j]
+			}
+			c[i*n+j] = s
+		}
+	}
+}
+
+// MatMulReordered swaps the loops to i-k-j, so the inner loop streams rows of b
+// and c sequentially. Same arithmetic, no tiling.
+func MatMulReordered(a, b, c []float64, n int) {
+	clear(c[:n*n])
+	for i := 0; i < n; i++ {
+		ci := c[i*n : i*n+n]
+		for k := 0; k < n; k++ {
+			aik := a[i*n+k]
+			bk := b[k*n : k*n+n]
+			for j := range ci {
+				ci[j] += aik * bk[j]
+			}
+		}
+	}
+}
+
+// MatMulTiled splits the i, k and j loops into tile*tile blocks so the working
+// set of one block step (a tile of a, b and c) stays in cache while it is reused.
+func MatMulTiled(a, b, c []float64, n, tile int) {
+	if tile <= 0 || tile >= n {
+		MatMulReordered(a, b, c, n)
+		return
+	}
+	clear(c[:n*n])
+	for ii := 0; ii < n; ii += tile {
+		iEnd := min(ii+tile, n)
+		for kk := 0; kk < n; kk += tile {
+			kEnd := min(kk+tile, n)
+			for jj := 0; jj < n; jj += tile {
+				jEnd := min(jj+tile, n)
+				for i := ii; i < iEnd; i++ {
+					ci := c[i*n+jj : i*n+jEnd]
+					for k := kk; k < kEnd; k++ {
+						aik := a[i*n+k]
+						bk := b[k*n+jj : k*n+jEnd]
+						for j := range ci {
+							ci[j] += aik * bk[j]
+						}
+					}
+				}
+			}
+		}
+	}
+}
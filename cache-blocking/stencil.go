@@ -0,0 +1,63 @@
+package cacheblocking
+
+// The stencil is a 5-point Jacobi step on an n*n row-major grid:
+//
+//	dst[i][j] = (src[i][j] + src[i-1][j] + src[i+1][j] + src[i][j-1] + src[i][j+1]) / 5
+//
+// Border cells are copied unchanged.
+
+// StencilNaive walks the grid column by column, the way code ported from
+// column-major (Fortran/MATLAB) layouts often does. Each step jumps n*8 bytes.
+func StencilNaive(src, dst []float64, n int) {
+	copyBorder(src, dst, n)
+	for j := 1; j < n-1; j++ {
+		for i := 1; i < n-1; i++ {
+			dst[i*n+j] = stencilAt(src, n, i, j)
+		}
+	}
+}
+
+// StencilReordered walks the grid row by row, so the three source rows and the
+// destination row are all read sequentially.
+func StencilReordered(src, dst []float64, n int) {
+	copyBorder(src, dst, n)
+	for i := 1; i < n-1; i++ {
+		for j := 1; j < n-1; j++ {
+			dst[i*n+j] = stencilAt(src, n, i, j)
+		}
+	}
+}
+
+// StencilTiled processes the grid in tile*tile blocks. Rows inside a block are
+// short enough that the neighbouring rows are still in cache when reused.
+func StencilTiled(src, dst []float64, n, tile int) {
+	if tile <= 0 || tile >= n {
+		StencilReordered(src, dst, n)
+		return
+	}
+	copyBorder(src, dst, n)
+	for ii := 1; ii < n-1; ii += tile {
+		iEnd := min(ii+tile, n-1)
+		for jj := 1; jj < n-1; jj += tile {
+			jEnd := min(jj+tile, n-1)
+			for i := ii; i < iEnd; i++ {
+				for j := jj; j < jEnd; j++ {
+					dst[i*n+j] = stencilAt(src, n, i, j)
+				}
+			}
+		}
+	}
+}
+
+func stencilAt(src []float64, n, i, j int) float64 {
+	return (src[i*n+j] + src[(i-1)*n+j] + src[(i+1)*n+j] + src[i*n+j-1] + src[i*n+j+1]) / 5
+}
+
+func copyBorder(src, dst []float64, n int) {
+	copy(dst[:n], src[:n])
+	copy(dst[(n-1)*n:n*n], src[(n-1)*n:n*n])
+	for i := 1; i < n-1; i++ {
+		dst[i*n] = src[i*n]
+		dst[i*n+n-1] = src[i*n+n-1]
+	}
+}
@@ -0,0 +1,85 @@
+package cacheblocking
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Fallbacks when the cache hierarchy cannot be read (non-Linux, containers
+// without sysfs). They match a typical modern x86 core.
+const (
+	defaultL1 = 32 * 1024
+	defaultL2 = 1024 * 1024
+)
+
+// CacheSizes returns the L1 data and L2 cache sizes in bytes for cpu0.
+func CacheSizes() (l1, l2 int) {
+	l1, l2 = defaultL1, defaultL2
+
+	dirs, _ := filepath.Glob("/sys/devices/system/cpu/cpu0/cache/index*")
+	for _, dir := range dirs {
+		level := readSysfs(dir, "level")
+		typ := readSysfs(dir, "type")
+		size, ok := parseCacheSize(readSysfs(dir, "size"))
+		if !ok {
+			continue
+		}
+		switch {
+		case level == "1" && typ == "Data":
+			l1 = size
+		case level == "2" && typ != "Instruction":
+			l2 = size
+		}
+	}
+	return l1, l2
+}
+
+// TileForCache returns the largest tile edge (a multiple of 8, i.e. one cache
+// line of float64) such that three tile*tile float64 blocks fit in cacheBytes.
+// Three blocks because a tiled matmul step keeps a tile of a, b and c hot.
+func TileForCache(cacheBytes int) int {
+	t := int(math.Sqrt(float64(cacheBytes) / (3 * 8)))
+	t &^= 7
+	if t < 8 {
+		t = 8
+	}
+	return t
+}
+
+// AutoTile picks a tile size for the current machine's L1 data cache.
+func AutoTile() int {
+	l1, _ := CacheSizes()
+	return TileForCache(l1)
+}
+
+func readSysfs(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// parseCacheSize parses sysfs sizes like "48K" or "2048K" or "32M".
+func parseCacheSize(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	mult := 1
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1024
+		s = s[:len(s)-1]
+	case 'M':
+		mult = 1024 * 1024
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v * mult, true
+}
@@ -21,10 +21,37 @@ type ParticleSoA struct {
 	Mass []float64
 }
 
+// ParticleBlock groups blockWidth particles field by field (array-of-structs-of-arrays).
+// Each field array is exactly one 64-byte cache line, so a kernel that touches k fields
+// pulls k lines per block and nothing else.
+type ParticleBlock struct {
+	X    [blockWidth]float64
+	Y    [blockWidth]float64
+	Z    [blockWidth]float64
+	Mass [blockWidth]float64
+}
+
 const particleCount = 1 << 21 // 2,097,152 elements -> ~64 MB AoS vs ~16 MB SoA per component stream
 
+const blockWidth = 8 // 8 float64 = one cache line per field
+
+// point used by the distance kernel
+const (
+	px = 10.0
+	py = 20.0
+	pz = 30.0
+)
+
+// Sink is global so compiler cannot eliminate the reduction kernels
+var sink float64
+
 func makeAoS() []Particle {
 	particles := make([]Particle, particleCount)
+	fillAoS(particles)
+	return particles
+}
+
+func fillAoS(particles []Particle) {
 	for i := range particles {
 		v := float64(i%1024) + 0.1
 		particles[i] = Particle{
@@ -34,7 +61,6 @@ func makeAoS() []Particle {
 			Mass: 1.0,
 		}
 	}
-	return particles
 }
 
 func makeSoA() ParticleSoA {
@@ -42,16 +68,130 @@ func makeSoA() ParticleSoA {
 	ys := make([]float64, particleCount)
 	zs := make([]float64, particleCount)
 	ms := make([]float64, particleCount)
+	particles := ParticleSoA{Xs: xs, Ys: ys, Zs: zs, Mass: ms}
+	fillSoA(particles)
+	return particles
+}
 
-	for i := 0; i < particleCount; i++ {
+func fillSoA(particles ParticleSoA) {
+	xs, ys, zs, ms := particles.Xs, particles.Ys, particles.Zs, particles.Mass
+	for i := range xs {
 		v := float64(i%1024) + 0.1
 		xs[i] = v
 		ys[i] = v * 2
 		zs[i] = v * 3
 		ms[i] = 1.0
 	}
+}
+
+func makeAoSoA() []ParticleBlock {
+	blocks := make([]ParticleBlock, particleCount/blockWidth)
+	fillAoSoA(blocks)
+	return blocks
+}
+
+func fillAoSoA(blocks []ParticleBlock) {
+	for i := 0; i < len(blocks)*blockWidth; i++ {
+		v := float64(i%1024) + 0.1
+		blk := &blocks[i/blockWidth]
+		lane := i % blockWidth
+		blk.X[lane] = v
+		blk.Y[lane] = v * 2
+		blk.Z[lane] = v * 3
+		blk.Mass[lane] = 1.0
+	}
+}
+
+// --- Section: Kernels ---
+
+// Position update touches one field: X.
+// Kinetic energy touches two fields: Mass and X (read as velocity along one axis).
+// Distance to a point touches all four: mass-weighted squared distance (X, Y, Z, Mass).
+
+func kineticAoS(ps []Particle) float64 {
+	var e float64
+	for j := range ps {
+		e += 0.5 * ps[j].Mass * ps[j].X * ps[j].X
+	}
+	return e
+}
+
+func kineticSoA(ps ParticleSoA) float64 {
+	var e float64
+	xs, ms := ps.Xs, ps.Mass[:len(ps.Xs)]
+	for j := range xs {
+		e += 0.5 * ms[j] * xs[j] * xs[j]
+	}
+	return e
+}
+
+// The AoSoA kernels spell out the 8 lanes of a block. Go neither vectorizes nor
+// unrolls, so an inner `for k := 0; k < blockWidth; k++` pays a compare and
+// branch per particle and chains every lane's add through one accumulator.
+// Written out, the lanes are summed first and only one add per block sits on
+// the loop-carried dependency, which is the scalar stand-in for a SIMD lane.
+
+func moveAoSoA(blocks []ParticleBlock) {
+	for j := range blocks {
+		x := &blocks[j].X
+		x[0] += 1
+		x[1] += 1
+		x[2] += 1
+		x[3] += 1
+		x[4] += 1
+		x[5] += 1
+		x[6] += 1
+		x[7] += 1
+	}
+}
+
+func kineticLane(blk *ParticleBlock, k int) float64 {
+	return 0.5 * blk.Mass[k] * blk.X[k] * blk.X[k]
+}
+
+func kineticAoSoA(blocks []ParticleBlock) float64 {
+	var e float64
+	for j := range blocks {
+		blk := &blocks[j]
+		e += kineticLane(blk, 0) + kineticLane(blk, 1) + kineticLane(blk, 2) + kineticLane(blk, 3) +
+			kineticLane(blk, 4) + kineticLane(blk, 5) + kineticLane(blk, 6) + kineticLane(blk, 7)
+	}
+	return e
+}
+
+func distanceAoS(ps []Particle) float64 {
+	var d float64
+	for j := range ps {
+		dx, dy, dz := ps[j].X-px, ps[j].Y-py, ps[j].Z-pz
+		d += ps[j].Mass * (dx*dx + dy*dy + dz*dz)
+	}
+	return d
+}
 
-	return ParticleSoA{Xs: xs, Ys: ys, Zs: zs, Mass: ms}
+func distanceSoA(ps ParticleSoA) float64 {
+	var d float64
+	xs := ps.Xs
+	ys, zs, ms := ps.Ys[:len(xs)], ps.Zs[:len(xs)], ps.Mass[:len(xs)]
+	for j := range xs {
+		dx, dy, dz := xs[j]-px, ys[j]-py, zs[j]-pz
+		d += ms[j] * (dx*dx + dy*dy + dz*dz)
+	}
+	return d
+}
+
+func distanceLane(blk *ParticleBlock, k int) float64 {
+	dx, dy, dz := blk.X[k]-px, blk.Y[k]-py, blk.Z[k]-pz
+	return blk.Mass[k] * (dx*dx + dy*dy + dz*dz)
+}
+
+func distanceAoSoA(blocks []ParticleBlock) float64 {
+	var d float64
+	for j := range blocks {
+		blk := &blocks[j]
+		d += distanceLane(blk, 0) + distanceLane(blk, 1) + distanceLane(blk, 2) + distanceLane(blk, 3) +
+			distanceLane(blk, 4) + distanceLane(blk, 5) + distanceLane(blk, 6) + distanceLane(blk, 7)
+	}
+	return d
 }
 
 func BenchmarkArrayOfStructs(b *testing.B) {
@@ -92,3 +232,302 @@ func BenchmarkStructOfArrays(b *testing.B) {
 	}
 	runtime.KeepAlive(particles)
 }
+
+func BenchmarkArrayOfStructsOfArrays(b *testing.B) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_ = makeAoSoA()
+	runtime.ReadMemStats(&after)
+	b.Logf("bytes allocated: %d", after.TotalAlloc-before.TotalAlloc)
+	b.ReportAllocs()
+	b.ResetTimer()
+	blocks := makeAoSoA()
+
+	for i := 0; i < b.N; i++ {
+		moveAoSoA(blocks)
+	}
+	runtime.KeepAlive(blocks)
+}
+
+// --- Section: Two fields (kinetic energy) ---
+
+func BenchmarkKineticEnergyAoS(b *testing.B) {
+	particles := makeAoS()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = kineticAoS(particles)
+	}
+}
+
+func BenchmarkKineticEnergySoA(b *testing.B) {
+	particles := makeSoA()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = kineticSoA(particles)
+	}
+}
+
+func BenchmarkKineticEnergyAoSoA(b *testing.B) {
+	blocks := makeAoSoA()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = kineticAoSoA(blocks)
+	}
+}
+
+// --- Section: All four fields (distance to a point) ---
+
+func BenchmarkDistanceAoS(b *testing.B) {
+	particles := makeAoS()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = distanceAoS(particles)
+	}
+}
+
+func BenchmarkDistanceSoA(b *testing.B) {
+	particles := makeSoA()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = distanceSoA(particles)
+	}
+}
+
+func BenchmarkDistanceAoSoA(b *testing.B) {
+	blocks := makeAoSoA()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = distanceAoSoA(blocks)
+	}
+}
+
+// --- Section: Cache-resident working set ---
+
+// inCacheCount particles take 128 KB as AoS: the whole set stays in L2, so the
+// kernels are bound by instructions rather than memory traffic.
+const inCacheCount = 4096
+
+func BenchmarkInCache(b *testing.B) {
+	aos := makeAoS()[:inCacheCount]
+	all := makeSoA()
+	soa := ParticleSoA{
+		Xs:   all.Xs[:inCacheCount],
+		Ys:   all.Ys[:inCacheCount],
+		Zs:   all.Zs[:inCacheCount],
+		Mass: all.Mass[:inCacheCount],
+	}
+	blocks := makeAoSoA()[:inCacheCount/blockWidth]
+
+	kernels := []struct {
+		name string
+		run  func()
+	}{
+		{"Position/AoS", func() {
+			particles := aos
+			for j := range particles {
+				particles[j].X += 1
+			}
+		}},
+		{"Position/SoA", func() {
+			xs := soa.Xs
+			for j := range xs {
+				xs[j] += 1
+			}
+		}},
+		{"Position/AoSoA", func() { moveAoSoA(blocks) }},
+		{"KineticEnergy/AoS", func() { sink = kineticAoS(aos) }},
+		{"KineticEnergy/SoA", func() { sink = kineticSoA(soa) }},
+		{"KineticEnergy/AoSoA", func() { sink = kineticAoSoA(blocks) }},
+		{"Distance/AoS", func() { sink = distanceAoS(aos) }},
+		{"Distance/SoA", func() { sink = distanceSoA(soa) }},
+		{"Distance/AoSoA", func() { sink = distanceAoSoA(blocks) }},
+	}
+	for _, k := range kernels {
+		b.Run(k.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				k.run()
+			}
+		})
+	}
+}
+
+// --- Section: Huge pages ---
+
+// The heap variants above map ~64 MB with 4 KB pages: 16K TLB entries for one AoS pass.
+// Backing the same arrays with 2 MB pages needs 32.
+
+func makeHugeAoS(b *testing.B) []Particle {
+	h, err := NewHugeSlice[Particle](particleCount, true)
+	if err != nil {
+		b.Fatalf("huge alloc: %v", err)
+	}
+	b.Cleanup(func() { _ = h.Free() })
+	b.Logf("hugetlb=%v thp=%v", h.HugeTLB, h.THP)
+	fillAoS(h.Data)
+	return h.Data
+}
+
+func makeHugeSoA(b *testing.B) ParticleSoA {
+	field := func() []float64 {
+		h, err := NewHugeSlice[float64](particleCount, true)
+		if err != nil {
+			b.Fatalf("huge alloc: %v", err)
+		}
+		b.Cleanup(func() { _ = h.Free() })
+		return h.Data
+	}
+	particles := ParticleSoA{Xs: field(), Ys: field(), Zs: field(), Mass: field()}
+	fillSoA(particles)
+	return particles
+}
+
+func makeHugeAoSoA(b *testing.B) []ParticleBlock {
+	h, err := NewHugeSlice[ParticleBlock](particleCount/blockWidth, true)
+	if err != nil {
+		b.Fatalf("huge alloc: %v", err)
+	}
+	b.Cleanup(func() { _ = h.Free() })
+	fillAoSoA(h.Data)
+	return h.Data
+}
+
+func TestHugeSlice(t *testing.T) {
+	h, err := NewHugeSlice[Particle](1000, true)
+	if err != nil {
+		t.Fatalf("huge alloc: %v", err)
+	}
+	if len(h.Data) != 1000 {
+		t.Fatalf("len = %d, want 1000", len(h.Data))
+	}
+	fillAoS(h.Data)
+	if h.Data[999].Z != (999%1024+0.1)*3 {
+		t.Fatalf("unexpected value %v", h.Data[999].Z)
+	}
+	if err := h.Free(); err != nil {
+		t.Fatalf("free: %v", err)
+	}
+}
+
+func TestHugeSliceRejectsPointers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the heap fallback may hold pointers")
+	}
+	type withString struct {
+		X    float64
+		Name string
+	}
+	if _, err := NewHugeSlice[withString](10, false); err == nil {
+		t.Fatal("struct with a string accepted")
+	}
+	if _, err := NewHugeSlice[[4]*int](10, false); err == nil {
+		t.Fatal("array of pointers accepted")
+	}
+}
+
+func BenchmarkArrayOfStructsHugePages(b *testing.B) {
+	particles := makeHugeAoS(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(particles); j++ {
+			particles[j].X += 1
+		}
+	}
+}
+
+func BenchmarkStructOfArraysHugePages(b *testing.B) {
+	particles := makeHugeSoA(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(particles.Xs); j++ {
+			particles.Xs[j] += 1
+		}
+	}
+}
+
+func BenchmarkArrayOfStructsOfArraysHugePages(b *testing.B) {
+	blocks := makeHugeAoSoA(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		moveAoSoA(blocks)
+	}
+}
+
+func BenchmarkKineticEnergyAoSHugePages(b *testing.B) {
+	particles := makeHugeAoS(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = kineticAoS(particles)
+	}
+}
+
+func BenchmarkKineticEnergySoAHugePages(b *testing.B) {
+	particles := makeHugeSoA(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = kineticSoA(particles)
+	}
+}
+
+func BenchmarkKineticEnergyAoSoAHugePages(b *testing.B) {
+	blocks := makeHugeAoSoA(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = kineticAoSoA(blocks)
+	}
+}
+
+func BenchmarkDistanceAoSHugePages(b *testing.B) {
+	particles := makeHugeAoS(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = distanceAoS(particles)
+	}
+}
+
+func BenchmarkDistanceSoAHugePages(b *testing.B) {
+	particles := makeHugeSoA(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = distanceSoA(particles)
+	}
+}
+
+func BenchmarkDistanceAoSoAHugePages(b *testing.B) {
+	blocks := makeHugeAoSoA(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sink = distanceAoSoA(blocks)
+	}
+}
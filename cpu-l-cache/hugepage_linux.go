@@ -0,0 +1,104 @@
+//go:build linux
+
+package cpulcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const hugePageSize = 2 << 20 // 2 MB, the x86-64/arm64 default huge page
+
+// HugeSlice is a typed slice backed by anonymous mmap memory instead of the Go heap.
+// The memory is invisible to the GC, so T must not contain pointers;
+// NewHugeSlice rejects types that do.
+type HugeSlice[T any] struct {
+	Data    []T
+	HugeTLB bool // backed by reserved MAP_HUGETLB pages
+	THP     bool // madvise(MADV_HUGEPAGE) accepted, transparent huge pages allowed
+
+	mem []byte // original mapping, needed for munmap
+}
+
+// NewHugeSlice maps n elements of T. With tryHugeTLB it first asks for explicit
+// huge pages (needs vm.nr_hugepages > 0) and silently falls back to a regular
+// mapping advised with MADV_HUGEPAGE.
+func NewHugeSlice[T any](n int, tryHugeTLB bool) (*HugeSlice[T], error) {
+	if t := reflect.TypeFor[T](); typeHasPointers(t) {
+		return nil, fmt.Errorf("huge slice of %v: type contains pointers", t)
+	}
+	var zero T
+	size := int(unsafe.Sizeof(zero)) * n
+	if size == 0 {
+		return &HugeSlice[T]{}, nil
+	}
+	size = (size + hugePageSize - 1) &^ (hugePageSize - 1)
+
+	h := &HugeSlice[T]{}
+	if tryHugeTLB {
+		mem, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE,
+			unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_HUGETLB)
+		if err == nil {
+			h.mem, h.HugeTLB = mem, true
+			h.Data = unsafe.Slice((*T)(unsafe.Pointer(&mem[0])), n)
+			return h, nil
+		}
+	}
+
+	// THP only backs 2 MB-aligned ranges, and mmap only guarantees 4 KB alignment,
+	// so over-map by one huge page and start at the first aligned address.
+	mem, err := unix.Mmap(-1, 0, size+hugePageSize, unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, fmt.Errorf("mmap %d bytes: %w", size, err)
+	}
+	off := int(-uintptr(unsafe.Pointer(&mem[0])) & (hugePageSize - 1))
+	region := mem[off : off+size]
+
+	err = unix.Madvise(region, unix.MADV_HUGEPAGE)
+	switch {
+	case err == nil:
+		h.THP = true
+	case errors.Is(err, unix.EINVAL):
+		// kernel built without THP: keep the mapping, just without the advice
+	default:
+		_ = unix.Munmap(mem)
+		return nil, fmt.Errorf("madvise: %w", err)
+	}
+
+	h.mem = mem
+	h.Data = unsafe.Slice((*T)(unsafe.Pointer(&region[0])), n)
+	return h, nil
+}
+
+// Free unmaps the memory. Data must not be used afterwards.
+func (h *HugeSlice[T]) Free() error {
+	if h.mem == nil {
+		return nil
+	}
+	err := unix.Munmap(h.mem)
+	h.mem, h.Data = nil, nil
+	return err
+}
+
+// typeHasPointers reports whether values of t hold pointers the GC must see.
+func typeHasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.String, reflect.Slice,
+		reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	case reflect.Array:
+		return t.Len() > 0 && typeHasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if typeHasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
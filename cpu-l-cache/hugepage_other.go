@@ -0,0 +1,20 @@
+//go:build !linux
+
+package cpulcache
+
+// HugeSlice falls back to a regular heap slice where MADV_HUGEPAGE does not exist
+// (macOS uses superpages only for specific allocations), so the benchmarks still run.
+type HugeSlice[T any] struct {
+	Data    []T
+	HugeTLB bool
+	THP     bool
+}
+
+func NewHugeSlice[T any](n int, tryHugeTLB bool) (*HugeSlice[T], error) {
+	return &HugeSlice[T]{Data: make([]T, n)}, nil
+}
+
+func (h *HugeSlice[T]) Free() error {
+	h.Data = nil
+	return nil
+}
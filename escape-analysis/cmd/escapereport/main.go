@@ -0,0 +1,125 @@
+// Command escapereport compiles a package with -gcflags=-m=2 and reports the
+// compiler's escape-analysis decisions as structured records.
+//
+//	escapereport ../interface-value-copy                    # table of heap decisions
+//	escapereport -json -o base.json ../object-pool           # save a run
+//	escapereport -base base.json ../object-pool              # diff; exit 1 on new escapes
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	escapeanalysis "github.com/creotiv/go-hiload/escape-analysis"
+)
+
+func main() {
+	tests := flag.Bool("tests", true, "compile the test binary (go test -c) so _test.go hot paths are included")
+	all := flag.Bool("all", false, "also list values that do not escape")
+	asJSON := flag.Bool("json", false, "print records as JSON")
+	out := flag.String("o", "", "write JSON records to this file instead of stdout")
+	base := flag.String("base", "", "JSON records of a previous run to diff against")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: escapereport [flags] [package dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	records, err := escapeanalysis.Run(dir, *tests)
+	if err != nil {
+		fatal(err)
+	}
+	if !*all {
+		records = heapOnly(records)
+	}
+
+	switch {
+	case *base != "":
+		os.Exit(diff(*base, records))
+	case *asJSON || *out != "":
+		writeJSON(*out, records)
+	default:
+		printTable(records)
+	}
+}
+
+// diff prints added and removed records and returns 1 if any new value now
+// lives on the heap, so it can gate CI.
+func diff(path string, head []escapeanalysis.Record) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fatal(err)
+	}
+	var prev []escapeanalysis.Record
+	if err := json.Unmarshal(data, &prev); err != nil {
+		fatal(fmt.Errorf("%s: %w", path, err))
+	}
+
+	added, removed := escapeanalysis.Diff(prev, head)
+	code := 0
+	for _, r := range added {
+		fmt.Printf("+ %s\n", r)
+		if r.Reason != "" {
+			fmt.Printf("    %s\n", r.Reason)
+		}
+		if r.Kind == escapeanalysis.KindEscapes || r.Kind == escapeanalysis.KindMoved {
+			code = 1
+		}
+	}
+	for _, r := range removed {
+		fmt.Printf("- %s\n", r)
+	}
+	if code != 0 {
+		fmt.Fprintln(os.Stderr, "escapereport: new heap escapes")
+	}
+	return code
+}
+
+func heapOnly(records []escapeanalysis.Record) []escapeanalysis.Record {
+	out := records[:0]
+	for _, r := range records {
+		if r.Kind.Heap() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func writeJSON(path string, records []escapeanalysis.Record) {
+	w := os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(records); err != nil {
+		fatal(err)
+	}
+}
+
+func printTable(records []escapeanalysis.Record) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POSITION\tKIND\tVAR\tFUNC\tREASON")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%s:%d:%d\t%s\t%s\t%s\t%s\n", r.File, r.Line, r.Col, r.Kind, r.Var, r.Func, r.Reason)
+	}
+	tw.Flush()
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "escapereport:", err)
+	os.Exit(2)
+}
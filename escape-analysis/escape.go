@@ -0,0 +1,206 @@
+package escapeanalysis
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Kind classifies one escape-analysis decision.
+type Kind string
+
+const (
+	KindEscapes  Kind = "escapes"   // "x escapes to heap": the value is heap allocated
+	KindMoved    Kind = "moved"     // "moved to heap: x": a variable whose address escapes
+	KindLeak     Kind = "leak"      // "leaking param: x": callers' arguments escape through it
+	KindNoEscape Kind = "no-escape" // "x does not escape"
+)
+
+// Heap reports whether the decision costs an allocation or makes callers allocate.
+func (k Kind) Heap() bool { return k != KindNoEscape }
+
+// Record is one decision of the compiler for one value.
+type Record struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Col    int    `json:"col"`
+	Func   string `json:"func,omitempty"` // enclosing function, known for heap decisions only
+	Var    string `json:"var"`            // variable or expression as printed by the compiler
+	Kind   Kind   `json:"kind"`
+	Reason string `json:"reason,omitempty"` // -m=2 flow explanation, "; "-separated
+}
+
+func (r Record) String() string {
+	s := fmt.Sprintf("%s:%d:%d: %s %s", r.File, r.Line, r.Col, r.Kind, r.Var)
+	if r.Func != "" {
+		s += " in " + r.Func
+	}
+	return s
+}
+
+// Run compiles the package in dir with -gcflags=-m=2 and parses the output.
+// With tests set it compiles the test binary (go test -c), which is where most
+// hot paths of this repo live; otherwise it runs go build.
+func Run(dir string, tests bool) ([]Record, error) {
+	args := []string{"build", "-gcflags=-m=2", "-o", os.DevNull, "."}
+	if tests {
+		args = []string{"test", "-c", "-gcflags=-m=2", "-o", os.DevNull, "."}
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go %s: %w\n%s", strings.Join(args, " "), err, out.Bytes())
+	}
+	return Parse(&out)
+}
+
+// Parse reads compiler -m/-m=2 diagnostics. Summary lines become records;
+// -m=2 explanation blocks at the same position fill in Func and Reason:
+//
+//	./f.go:54:20: v escapes to heap in Bench:
+//	./f.go:54:20:   flow: {heap} ← &{storage for v}:
+//	./f.go:54:20:     from ifaceSink = v (assign) at ./f.go:54:19
+//	./f.go:54:20: v escapes to heap
+//
+// Generated files (_testmain.go, <autogenerated>) and inlining notes are skipped.
+func Parse(r io.Reader) ([]Record, error) {
+	type explain struct {
+		fn     string
+		reason []string
+	}
+	var (
+		records  []Record
+		explains = map[string]*explain{}
+		current  *explain
+	)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		pos, file, ln, col, msg, ok := splitPos(line)
+		if !ok || !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_testmain.go") {
+			continue
+		}
+
+		// indented lines continue the explanation started at the same position
+		if strings.HasPrefix(msg, " ") {
+			if current != nil {
+				current.reason = append(current.reason, strings.TrimSuffix(strings.TrimSpace(msg), ":"))
+			}
+			continue
+		}
+		current = nil
+
+		if fn, ok := explainFunc(msg); ok {
+			current = &explain{fn: fn}
+			explains[pos] = current
+			continue
+		}
+
+		rec := Record{File: file, Line: ln, Col: col}
+		switch {
+		case strings.HasSuffix(msg, " escapes to heap"):
+			rec.Kind, rec.Var = KindEscapes, strings.TrimSuffix(msg, " escapes to heap")
+		case strings.HasPrefix(msg, "moved to heap: "):
+			rec.Kind, rec.Var = KindMoved, strings.TrimPrefix(msg, "moved to heap: ")
+		case strings.HasPrefix(msg, "leaking param content: "):
+			rec.Kind, rec.Var = KindLeak, "content of "+strings.TrimPrefix(msg, "leaking param content: ")
+		case strings.HasPrefix(msg, "leaking param: "):
+			rec.Kind, rec.Var = KindLeak, strings.TrimPrefix(msg, "leaking param: ")
+		case strings.HasSuffix(msg, " does not escape"):
+			rec.Kind, rec.Var = KindNoEscape, strings.TrimSuffix(msg, " does not escape")
+		default:
+			continue
+		}
+		if e := explains[pos]; e != nil {
+			rec.Func = e.fn
+			rec.Reason = strings.Join(e.reason, "; ")
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
+
+// explainFunc recognises -m=2 explanation headers and returns the function:
+//
+//	x escapes to heap in F:
+//	parameter v leaks to {heap} for F with derefs=0:
+func explainFunc(msg string) (string, bool) {
+	if !strings.HasSuffix(msg, ":") {
+		return "", false
+	}
+	msg = strings.TrimSuffix(msg, ":")
+	if _, fn, ok := strings.Cut(msg, " escapes to heap in "); ok {
+		return fn, true
+	}
+	if strings.HasPrefix(msg, "parameter ") {
+		if _, rest, ok := strings.Cut(msg, " for "); ok {
+			fn, _, _ := strings.Cut(rest, " with ")
+			return fn, true
+		}
+	}
+	return "", false
+}
+
+// splitPos splits "./file.go:12:5: message" into its parts.
+func splitPos(line string) (pos, file string, ln, col int, msg string, ok bool) {
+	parts := strings.SplitN(line, ":", 4)
+	if len(parts) != 4 {
+		return "", "", 0, 0, "", false
+	}
+	ln, err1 := strconv.Atoi(parts[1])
+	col, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil {
+		return "", "", 0, 0, "", false
+	}
+	file = strings.TrimPrefix(parts[0], "./")
+	msg = strings.TrimPrefix(parts[3], " ")
+	return parts[0] + ":" + parts[1] + ":" + parts[2], file, ln, col, msg, true
+}
+
+// Diff compares two runs. Records are matched on file, function, kind and
+// variable but not on line, so unrelated edits that shift code do not show up.
+// Duplicates are matched one to one.
+func Diff(base, head []Record) (added, removed []Record) {
+	key := func(r Record) string {
+		return r.File + "\x00" + r.Func + "\x00" + string(r.Kind) + "\x00" + r.Var
+	}
+	seen := make(map[string]int, len(base))
+	for _, r := range base {
+		seen[key(r)]++
+	}
+	for _, r := range head {
+		k := key(r)
+		if seen[k] > 0 {
+			seen[k]--
+			continue
+		}
+		added = append(added, r)
+	}
+
+	left := make(map[string]int, len(head))
+	for _, r := range head {
+		left[key(r)]++
+	}
+	for _, r := range base {
+		k := key(r)
+		if left[k] > 0 {
+			left[k]--
+			continue
+		}
+		removed = append(removed, r)
+	}
+	return added, removed
+}
@@ -0,0 +1,73 @@
+package escapeanalysis
+
+import (
+	"strings"
+	"testing"
+)
+
+// Captured from go test -c -gcflags=-m=2 (inlining notes trimmed).
+const sampleOutput = `# github.com/creotiv/go-hiload/interface-value-copy [github.com/creotiv/go-hiload/interface-value-copy.test]
+./bench_test.go:34:17: inlining call to consumePointer
+./bench_test.go:18:21: parameter v leaks to {heap} for consumePointer with derefs=0:
+./bench_test.go:18:21:   flow: {heap} ← v:
+./bench_test.go:18:21:     from ptrSink = v (assign) at ./bench_test.go:19:10
+./bench_test.go:18:21: leaking param: v
+./bench_test.go:28:34: b does not escape
+./bench_test.go:54:20: v escapes to heap in BenchmarkInterfaceValueCopy:
+./bench_test.go:54:20:   flow: {heap} ← &{storage for v}:
+./bench_test.go:54:20:     from ifaceSink = v (assign) at ./bench_test.go:54:19
+./bench_test.go:54:20: v escapes to heap
+./main.go:6:2: x escapes to heap in f:
+./main.go:6:2:   flow: {heap} ← &x:
+./main.go:6:2:     from &x (address-of) at ./main.go:7:6
+./main.go:6:2: moved to heap: x
+# github.com/creotiv/go-hiload/interface-value-copy.test
+_testmain.go:48:42: testdeps.TestDeps{} escapes to heap in main:
+_testmain.go:48:42: testdeps.TestDeps{} escapes to heap
+<autogenerated>:1: inlining call to reflect.flag.kind
+`
+
+func TestParse(t *testing.T) {
+	records, err := Parse(strings.NewReader(sampleOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Record{
+		{File: "bench_test.go", Line: 18, Col: 21, Func: "consumePointer", Var: "v", Kind: KindLeak,
+			Reason: "flow: {heap} ← v; from ptrSink = v (assign) at ./bench_test.go:19:10"},
+		{File: "bench_test.go", Line: 28, Col: 34, Var: "b", Kind: KindNoEscape},
+		{File: "bench_test.go", Line: 54, Col: 20, Func: "BenchmarkInterfaceValueCopy", Var: "v", Kind: KindEscapes,
+			Reason: "flow: {heap} ← &{storage for v}; from ifaceSink = v (assign) at ./bench_test.go:54:19"},
+		{File: "main.go", Line: 6, Col: 2, Func: "f", Var: "x", Kind: KindMoved,
+			Reason: "flow: {heap} ← &x; from &x (address-of) at ./main.go:7:6"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %v", len(records), len(want), records)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d:\n got %+v\nwant %+v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestDiffIgnoresLineShifts(t *testing.T) {
+	base := []Record{
+		{File: "a.go", Line: 10, Func: "F", Var: "x", Kind: KindMoved},
+		{File: "a.go", Line: 20, Func: "G", Var: "buf", Kind: KindEscapes},
+	}
+	head := []Record{
+		{File: "a.go", Line: 12, Func: "F", Var: "x", Kind: KindMoved}, // shifted, not a change
+		{File: "a.go", Line: 30, Func: "H", Var: "v", Kind: KindEscapes},
+		{File: "a.go", Line: 31, Func: "H", Var: "v", Kind: KindEscapes},
+	}
+
+	added, removed := Diff(base, head)
+	if len(added) != 2 || added[0].Func != "H" || added[1].Func != "H" {
+		t.Errorf("added = %v, want both H records", added)
+	}
+	if len(removed) != 1 || removed[0].Func != "G" {
+		t.Errorf("removed = %v, want G record", removed)
+	}
+}
@@ -0,0 +1 @@
+go run ./cmd/escapereport ../interface-value-copy
@@ -18,6 +18,13 @@ type memSnapshot struct {
 	heapInuse  uint64
 	stackInuse uint64
 	sysTotal   uint64
+
+	// what the OS sees, see readProcStats
+	rss         uint64
+	rssPeak     uint64
+	rssAnon     uint64
+	minorFaults uint64
+	majorFaults uint64
 }
 
 func BenchmarkGoroutineHeapBuffersRetained(b *testing.B) {
@@ -38,6 +45,7 @@ func BenchmarkGoroutineHeapBuffersRetained(b *testing.B) {
 		b.ReportMetric(float64(delta(after.stackInuse, before.stackInuse)), "stack_inuse_bytes")
 		b.ReportMetric(float64(delta(after.heapInuse, before.heapInuse)), "heap_inuse_bytes")
 		b.ReportMetric(float64(after.sysTotal), "process_sys_bytes")
+		reportOSMetrics(b, before, after)
 
 		for i := range retained {
 			retained[i] = nil
@@ -64,6 +72,7 @@ func BenchmarkGoroutineStackBuffers(b *testing.B) {
 		b.ReportMetric(float64(delta(after.stackInuse, before.stackInuse)), "stack_inuse_bytes")
 		b.ReportMetric(float64(delta(after.heapInuse, before.heapInuse)), "heap_inuse_bytes")
 		b.ReportMetric(float64(after.sysTotal), "process_sys_bytes")
+		reportOSMetrics(b, before, after)
 		b.StartTimer()
 	}
 }
@@ -116,11 +125,23 @@ func runHeapBuffers(retained [][]byte) {
 func snapshotMem() memSnapshot {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-	return memSnapshot{
+	s := memSnapshot{
 		heapInuse:  m.HeapInuse,
 		stackInuse: m.StackInuse,
 		sysTotal:   m.Sys,
 	}
+	readProcStats(&s)
+	return s
+}
+
+// reportOSMetrics reports RSS as an absolute value (like process_sys_bytes) so it
+// shows whether freed stacks and heap pages went back to the kernel, and page
+// faults as a per-iteration delta so it shows how often fresh pages were touched.
+func reportOSMetrics(b *testing.B, before, after memSnapshot) {
+	b.ReportMetric(float64(after.rss), "rss_bytes")
+	b.ReportMetric(float64(after.rssAnon), "rss_anon_bytes")
+	b.ReportMetric(float64(delta(after.minorFaults, before.minorFaults)), "minor_faults")
+	b.ReportMetric(float64(delta(after.majorFaults, before.majorFaults)), "major_faults")
 }
 
 func delta(after, before uint64) uint64 {
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package goroutinestack
+
+// readProcStats has no OS counters to read here; the OS metrics report 0.
+func readProcStats(s *memSnapshot) {}
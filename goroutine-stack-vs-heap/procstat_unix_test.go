@@ -0,0 +1,58 @@
+//go:build unix
+
+package goroutinestack
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// readProcStats fills the OS view of the process: resident set size, peak RSS
+// and anonymous RSS from /proc/self/status (Linux only), and minor/major page
+// faults from getrusage. Without /proc the peak comes from ru_maxrss.
+func readProcStats(s *memSnapshot) {
+	if data, err := os.ReadFile("/proc/self/status"); err == nil {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			line := sc.Bytes()
+			switch {
+			case bytes.HasPrefix(line, []byte("VmRSS:")):
+				s.rss = parseStatusKB(line)
+			case bytes.HasPrefix(line, []byte("VmHWM:")):
+				s.rssPeak = parseStatusKB(line)
+			case bytes.HasPrefix(line, []byte("RssAnon:")):
+				s.rssAnon = parseStatusKB(line)
+			}
+		}
+	}
+
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err == nil {
+		s.minorFaults = uint64(ru.Minflt)
+		s.majorFaults = uint64(ru.Majflt)
+		if s.rssPeak == 0 {
+			// ru_maxrss is in bytes on macOS, kilobytes elsewhere
+			s.rssPeak = uint64(ru.Maxrss)
+			if runtime.GOOS != "darwin" {
+				s.rssPeak *= 1024
+			}
+		}
+	}
+}
+
+// parseStatusKB parses a /proc status line like "VmRSS:	   12345 kB" into bytes.
+func parseStatusKB(line []byte) uint64 {
+	fields := bytes.Fields(line)
+	if len(fields) < 2 {
+		return 0
+	}
+	v, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v * 1024
+}
@@ -0,0 +1,160 @@
+package goroutinestack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// The matrix re-executes this test binary once per configuration, because GOGC,
+// GOMEMLIMIT and GODEBUG are read at startup and the scavenger keeps state for
+// the lifetime of the process. Each child runs one workload and prints one JSON
+// line which the parent collects into a table.
+//
+//	go test -run TestScavengerMatrix -scavenger-matrix -v
+
+var scavengerMatrix = flag.Bool("scavenger-matrix", false, "run the GOGC/GOMEMLIMIT/scavenger matrix in child processes")
+
+const (
+	childEnv     = "GOROUTINE_STACK_SCAVENGER_CHILD"
+	resultPrefix = "SCAVENGER_RESULT "
+	childRounds  = 200
+	idlePause    = 10 * time.Millisecond // lets the background scavenger run between rounds
+)
+
+type gcConfig struct {
+	gogc     string
+	memLimit string // empty means no limit
+}
+
+var (
+	matrixWorkloads = []string{"heap", "stack"}
+	matrixGC        = []gcConfig{
+		{gogc: "100"},
+		{gogc: "50"},
+		{gogc: "100", memLimit: "16MiB"},
+		{gogc: "off", memLimit: "32MiB"},
+	}
+	// none: rely on GC alone; idle: pause between rounds for the background
+	// scavenger; free: debug.FreeOSMemory after every round.
+	matrixRelease = []string{"none", "idle", "free"}
+)
+
+type childResult struct {
+	PeakRSS      uint64 `json:"peak_rss"`
+	FinalRSS     uint64 `json:"final_rss"`
+	HeapReleased uint64 `json:"heap_released"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+}
+
+func TestScavengerMatrix(t *testing.T) {
+	if spec := os.Getenv(childEnv); spec != "" {
+		runScavengerChild(t, spec)
+		return
+	}
+	if !*scavengerMatrix {
+		t.Skip("pass -scavenger-matrix to run child processes")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "workload\tGOGC\tGOMEMLIMIT\trelease\tpeak_rss_MB\tfinal_rss_MB\treleased_MB\tgc_count\tpause_total_ms\t")
+	for _, workload := range matrixWorkloads {
+		for _, gc := range matrixGC {
+			for _, release := range matrixRelease {
+				res, err := spawnScavengerChild(workload, gc, release)
+				if err != nil {
+					t.Fatalf("%s %+v %s: %v", workload, gc, release, err)
+				}
+				limit := gc.memLimit
+				if limit == "" {
+					limit = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.1f\t%.1f\t%.1f\t%d\t%.2f\t\n",
+					workload, gc.gogc, limit, release,
+					mb(res.PeakRSS), mb(res.FinalRSS), mb(res.HeapReleased),
+					res.NumGC, float64(res.PauseTotalNs)/1e6)
+			}
+		}
+	}
+	tw.Flush()
+}
+
+func spawnScavengerChild(workload string, gc gcConfig, release string) (childResult, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestScavengerMatrix$")
+	cmd.Env = append(os.Environ(),
+		childEnv+"="+workload+","+release,
+		"GOGC="+gc.gogc,
+	)
+	if gc.memLimit != "" {
+		cmd.Env = append(cmd.Env, "GOMEMLIMIT="+gc.memLimit)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return childResult{}, fmt.Errorf("child: %w\n%s", err, out)
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if line, ok := strings.CutPrefix(sc.Text(), resultPrefix); ok {
+			var res childResult
+			err := json.Unmarshal([]byte(line), &res)
+			return res, err
+		}
+	}
+	return childResult{}, fmt.Errorf("no result line in child output:\n%s", out)
+}
+
+func runScavengerChild(t *testing.T, spec string) {
+	workload, release, _ := strings.Cut(spec, ",")
+
+	var start runtime.MemStats
+	runtime.ReadMemStats(&start)
+
+	for i := 0; i < childRounds; i++ {
+		switch workload {
+		case "heap":
+			retained := make([][]byte, goroutineCount)
+			runHeapBuffers(retained)
+			runtime.KeepAlive(retained)
+		case "stack":
+			runStackBuffers()
+		default:
+			t.Fatalf("unknown workload %q", workload)
+		}
+
+		switch release {
+		case "idle":
+			time.Sleep(idlePause)
+		case "free":
+			debug.FreeOSMemory()
+		}
+	}
+
+	var end runtime.MemStats
+	runtime.ReadMemStats(&end)
+	var snap memSnapshot
+	readProcStats(&snap)
+
+	res := childResult{
+		PeakRSS:      snap.rssPeak,
+		FinalRSS:     snap.rss,
+		HeapReleased: end.HeapReleased,
+		NumGC:        end.NumGC - start.NumGC,
+		PauseTotalNs: end.PauseTotalNs - start.PauseTotalNs,
+	}
+	line, _ := json.Marshal(res)
+	fmt.Println(resultPrefix + string(line))
+}
+
+func mb(v uint64) float64 { return float64(v) / (1 << 20) }
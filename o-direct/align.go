@@ -0,0 +1,16 @@
+package directio
+
+import "unsafe"
+
+// BlockSize is the alignment O_DIRECT expects for buffer addresses, file
+// offsets and transfer lengths on common 4Kn/512e devices.
+const BlockSize = 4 * 1024
+
+// Aligned returns a zeroed size-byte slice whose first byte is BlockSize-aligned.
+func Aligned(size int) []byte {
+	mem := make([]byte, size+BlockSize-1)
+	ptr := uintptr(unsafe.Pointer(&mem[0]))
+	offset := int(ptr & (BlockSize - 1))
+	start := (BlockSize - offset) & (BlockSize - 1)
+	return mem[start : start+size]
+}
@@ -0,0 +1,164 @@
+package directio
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ReaderOptions configures an AlignedReader.
+type ReaderOptions struct {
+	// ChunkSize is the size of every read, a multiple of BlockSize. Reads
+	// start at multiples of it, so they satisfy any O_DIRECT alignment up to
+	// BlockSize. Defaults to 1 MiB.
+	ChunkSize int
+	// Readahead reads the chunk after the current one in a background
+	// goroutine, so the next chunk is usually in memory by the time a
+	// sequential reader gets to it (double buffering).
+	Readahead bool
+}
+
+const defaultChunkSize = 1 << 20
+
+// AlignedReader reads a file opened with O_DIRECT in large aligned chunks, so
+// callers can read arbitrary ranges into ordinary buffers: an unaligned range
+// is served from the chunks covering it. The last chunk read stays in memory,
+// which turns the small sequential reads of a scanner into one pread per chunk.
+// Chunk buffers come from a pool shared by all readers with the same chunk
+// size.
+//
+// The file must not change while it is read: chunks are not re-read. Safe for
+// concurrent use; reads are serialized.
+type AlignedReader struct {
+	r     io.ReaderAt
+	size  int
+	ahead bool
+
+	mu   sync.Mutex
+	cur  *chunk // last chunk read
+	next *chunk // chunk after cur being read ahead
+}
+
+type chunk struct {
+	off  int64
+	buf  []byte
+	n    int
+	err  error         // from ReadAt; set when n < len(buf)
+	done chan struct{} // closed when the read finished
+}
+
+// NewAlignedReader reads r, usually a File opened with direct set.
+func NewAlignedReader(r io.ReaderAt, opts ReaderOptions) (*AlignedReader, error) {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	if opts.ChunkSize <= 0 || opts.ChunkSize%BlockSize != 0 {
+		return nil, fmt.Errorf("directio: chunk size %d is not a multiple of %d", opts.ChunkSize, BlockSize)
+	}
+	return &AlignedReader{r: r, size: opts.ChunkSize, ahead: opts.Readahead}, nil
+}
+
+func (a *AlignedReader) ReadAt(p []byte, off int64) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	done := 0
+	for done < len(p) {
+		pos := off + int64(done)
+		c := a.chunkAt(pos - pos%int64(a.size))
+		i := int(pos - c.off)
+		if i >= c.n { // end of file or a failed read
+			err := c.err
+			if err != io.EOF {
+				a.drop() // do not cache the failure: a retry reads again
+			}
+			return done, err
+		}
+		done += copy(p[done:], c.buf[i:c.n])
+	}
+	return done, nil
+}
+
+// chunkAt makes the chunk at off current, reading it unless it already is or
+// was read ahead, and starts reading ahead the chunk after it.
+func (a *AlignedReader) chunkAt(off int64) *chunk {
+	if a.cur == nil || a.cur.off != off {
+		c := a.next
+		a.next = nil
+		if c != nil {
+			<-c.done
+			if c.off != off { // not sequential: the read-ahead chunk is useless
+				putChunk(c.buf)
+				c = nil
+			}
+		}
+		if c == nil {
+			c = a.read(off)
+			<-c.done
+		}
+		if a.cur != nil {
+			putChunk(a.cur.buf)
+		}
+		a.cur = c
+	}
+	if a.ahead && a.next == nil && a.cur.err == nil {
+		a.next = a.read(a.cur.off + int64(a.size))
+	}
+	return a.cur
+}
+
+// read starts reading the chunk at off, in the background with readahead.
+func (a *AlignedReader) read(off int64) *chunk {
+	c := &chunk{off: off, buf: getChunk(a.size), done: make(chan struct{})}
+	fill := func() {
+		c.n, c.err = a.r.ReadAt(c.buf, off)
+		if c.n < len(c.buf) && c.err == nil {
+			c.err = io.ErrUnexpectedEOF // a ReaderAt breaking its contract
+		}
+		close(c.done)
+	}
+	if a.ahead {
+		go fill()
+	} else {
+		fill()
+	}
+	return c
+}
+
+// drop returns the chunks to the pool.
+func (a *AlignedReader) drop() {
+	if a.next != nil {
+		<-a.next.done
+		putChunk(a.next.buf)
+		a.next = nil
+	}
+	if a.cur != nil {
+		putChunk(a.cur.buf)
+		a.cur = nil
+	}
+}
+
+// Close waits for a read ahead in flight and returns the buffers to the pool.
+// It does not close the underlying file. The reader stays usable: later reads
+// start afresh.
+func (a *AlignedReader) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.drop()
+	return nil
+}
+
+// chunkPools holds free chunk buffers, one *sync.Pool per chunk size.
+var chunkPools sync.Map
+
+func getChunk(size int) []byte {
+	p, _ := chunkPools.LoadOrStore(size, new(sync.Pool))
+	if b, ok := p.(*sync.Pool).Get().(*[]byte); ok {
+		return *b
+	}
+	return Aligned(size)
+}
+
+func putChunk(b []byte) {
+	p, _ := chunkPools.LoadOrStore(len(b), new(sync.Pool))
+	p.(*sync.Pool).Put(&b)
+}
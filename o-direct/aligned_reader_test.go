@@ -0,0 +1,134 @@
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// strictReaderAt serves data like an O_DIRECT file: reads must have an
+// aligned offset, length and buffer address.
+type strictReaderAt struct {
+	data  []byte
+	reads int
+}
+
+var errUnaligned = errors.New("unaligned read")
+
+func (s *strictReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.reads++
+	if off%BlockSize != 0 || len(p)%BlockSize != 0 || uintptr(unsafe.Pointer(&p[0]))%BlockSize != 0 {
+		return 0, errUnaligned
+	}
+	if off >= int64(len(s.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// testData is size bytes of a pattern that differs at every offset mod 251.
+func testData(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestAlignedReaderRandomRanges(t *testing.T) {
+	const size = 5*64*1024 + 1000 // ends in the middle of a block
+	data := testData(size)
+	for _, ahead := range []bool{false, true} {
+		t.Run(fmt.Sprintf("readahead=%v", ahead), func(t *testing.T) {
+			src := &strictReaderAt{data: data}
+			r, err := NewAlignedReader(src, ReaderOptions{ChunkSize: 64 * 1024, Readahead: ahead})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			rng := rand.New(rand.NewPCG(1, 2))
+			for range 2000 {
+				off := rng.Int64N(size + 100)
+				p := make([]byte, rng.IntN(3*64*1024))
+				n, err := r.ReadAt(p, off)
+				want := data[min(off, size):min(off+int64(len(p)), size)]
+				if n != len(want) || !bytes.Equal(p[:n], want) {
+					t.Fatalf("ReadAt(%d bytes, %d) = %d bytes, want %d", len(p), off, n, len(want))
+				}
+				switch {
+				case n < len(p) && err != io.EOF:
+					t.Fatalf("short read at %d: err %v, want io.EOF", off, err)
+				case n == len(p) && err != nil:
+					t.Fatalf("ReadAt(%d bytes, %d): %v", len(p), off, err)
+				}
+			}
+		})
+	}
+}
+
+// TestAlignedReaderSequentialPages reads page by page, the way the WAL
+// scanner does, and checks each chunk is read only once.
+func TestAlignedReaderSequentialPages(t *testing.T) {
+	const chunk, chunks = 64 * 1024, 8
+	for _, ahead := range []bool{false, true} {
+		src := &strictReaderAt{data: testData(chunk * chunks)}
+		r, _ := NewAlignedReader(src, ReaderOptions{ChunkSize: chunk, Readahead: ahead})
+		page := make([]byte, BlockSize)
+		for off := int64(0); off < chunk*chunks; off += BlockSize {
+			if _, err := r.ReadAt(page, off); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(page, src.data[off:off+BlockSize]) {
+				t.Fatalf("page at %d differs", off)
+			}
+		}
+		if _, err := r.ReadAt(page, chunk*chunks); err != io.EOF {
+			t.Fatalf("read past the end: %v", err)
+		}
+		r.Close()
+		if src.reads > chunks+1 {
+			t.Errorf("readahead=%v: %d reads for %d chunks", ahead, src.reads, chunks)
+		}
+	}
+}
+
+func TestAlignedReaderRejectsChunkSize(t *testing.T) {
+	if _, err := NewAlignedReader(&strictReaderAt{}, ReaderOptions{ChunkSize: 1000}); err == nil {
+		t.Fatal("chunk size 1000 accepted")
+	}
+}
+
+func TestAlignedReaderDirectFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seg")
+	data := testData(300*1024 + 17)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OS.OpenFile(path, false, true)
+	if err != nil {
+		t.Skipf("O_DIRECT: %v", err)
+	}
+	defer f.Close()
+	r, _ := NewAlignedReader(f, ReaderOptions{ChunkSize: 128 * 1024, Readahead: true})
+	defer r.Close()
+
+	got := make([]byte, len(data)+100)
+	n, err := r.ReadAt(got[:1], 0) // warm up, then one read across every chunk
+	if n != 1 || err != nil {
+		t.Fatalf("ReadAt: %d, %v", n, err)
+	}
+	n, err = r.ReadAt(got[3:], 3)
+	if n != len(data)-3 || err != io.EOF || !bytes.Equal(got[3:3+n], data[3:]) {
+		t.Fatalf("ReadAt(3) = %d, %v; want %d bytes and io.EOF", n, err, len(data)-3)
+	}
+}
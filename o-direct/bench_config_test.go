@@ -0,0 +1,168 @@
+//go:build linux
+
+package directio
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Parameters of the O_DIRECT vs buffered benchmarks. Each one is a flag of the
+// test binary and defaults to an environment variable, so both of these work:
+//
+//	go test -bench Write -args -dir=/mnt/nvme -block=16k -offsets=random
+//	DIRECTIO_DIR=/mnt/nvme DIRECTIO_BLOCK=16k go test -bench Write
+var (
+	benchDir      = flag.String("dir", envOr("DIRECTIO_DIR", os.TempDir()), "directory for the benchmark files ($DIRECTIO_DIR)")
+	benchBlock    = flag.String("block", envOr("DIRECTIO_BLOCK", "4k"), "size of each write ($DIRECTIO_BLOCK)")
+	benchFileSize = flag.String("filesize", envOr("DIRECTIO_FILE_SIZE", "64m"), "size of the preallocated file the writes land in ($DIRECTIO_FILE_SIZE)")
+	benchCommit   = flag.String("commit", envOr("DIRECTIO_COMMIT", "64"), "writes per fdatasync in the *Sync benchmarks ($DIRECTIO_COMMIT)")
+	benchOffsets  = flag.String("offsets", envOr("DIRECTIO_OFFSETS", "same"), "same, seq or random write offsets ($DIRECTIO_OFFSETS)")
+
+	sweep        = flag.Bool("sweep", os.Getenv("DIRECTIO_SWEEP") != "", "make BenchmarkSweep run and print a results table ($DIRECTIO_SWEEP)")
+	sweepBlocks  = flag.String("sweep.blocks", envOr("DIRECTIO_SWEEP_BLOCKS", "4k,16k,64k,256k"), "block sizes to sweep ($DIRECTIO_SWEEP_BLOCKS)")
+	sweepCommits = flag.String("sweep.commits", envOr("DIRECTIO_SWEEP_COMMITS", "0,1,16,64"), "commit intervals to sweep, 0 for never ($DIRECTIO_SWEEP_COMMITS)")
+)
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+type benchConfig struct {
+	dir      string
+	block    int
+	fileSize int64 // a multiple of block
+	commit   int   // writes per fdatasync; 0 never syncs
+	offsets  string
+}
+
+// Write offset patterns: every write rewrites block 0 (the original
+// benchmark), walks the file block by block, or picks blocks at random.
+var offsetPatterns = []string{"same", "seq", "random"}
+
+// loadBenchConfig parses the flags, failing the benchmark on bad values.
+func loadBenchConfig(tb testing.TB) benchConfig {
+	tb.Helper()
+	c := benchConfig{dir: *benchDir}
+	block, err := parseSize(*benchBlock)
+	if err != nil {
+		tb.Fatalf("-block: %v", err)
+	}
+	c.block = int(block)
+	if c.fileSize, err = parseSize(*benchFileSize); err != nil {
+		tb.Fatalf("-filesize: %v", err)
+	}
+	if c.commit, err = parseCount(*benchCommit); err != nil {
+		tb.Fatalf("-commit: %v", err)
+	}
+	if c.offsets = *benchOffsets; !slices.Contains(offsetPatterns, c.offsets) {
+		tb.Fatalf("-offsets: want one of %v, got %q", offsetPatterns, c.offsets)
+	}
+	if st, err := os.Stat(c.dir); err != nil || !st.IsDir() {
+		tb.Fatalf("-dir: %s is not a directory", c.dir)
+	}
+	return c.withBlock(tb, c.block)
+}
+
+// benchTempDir returns a fresh directory under -dir, removed when tb ends,
+// for benchmarks that need a directory of their own on the chosen volume.
+func benchTempDir(tb testing.TB) string {
+	tb.Helper()
+	dir, err := os.MkdirTemp(loadBenchConfig(tb).dir, "directio-bench-")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// withBlock switches to another block size, keeping the file a whole number
+// of blocks.
+func (c benchConfig) withBlock(tb testing.TB, block int) benchConfig {
+	tb.Helper()
+	if block <= 0 || int64(block) > c.fileSize {
+		tb.Fatalf("block size %d must be positive and at most the file size %d", block, c.fileSize)
+	}
+	c.block = block
+	c.fileSize -= c.fileSize % int64(block)
+	return c
+}
+
+// parseSize parses a byte count with an optional k, m or g suffix (powers of
+// 1024).
+func parseSize(s string) (int64, error) {
+	num := strings.ToLower(strings.TrimSpace(s))
+	shift := 0
+	switch {
+	case strings.HasSuffix(num, "k"):
+		shift = 10
+	case strings.HasSuffix(num, "m"):
+		shift = 20
+	case strings.HasSuffix(num, "g"):
+		shift = 30
+	}
+	if shift > 0 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n << shift, nil
+}
+
+// parseCount parses a count >= 0.
+func parseCount(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("want a count >= 0, got %q", s)
+	}
+	return n, nil
+}
+
+// parseList parses a comma-separated list with parse.
+func parseList[T any](s string, parse func(string) (T, error)) ([]T, error) {
+	var out []T
+	for _, f := range strings.Split(s, ",") {
+		v, err := parse(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"4096": 4096, "4k": 4096, "16K": 16 << 10, "64m": 64 << 20, " 1g ": 1 << 30} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "k", "-4k", "4x", "0"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) did not fail", in)
+		}
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	for in, want := range map[string]int{"0": 0, "64": 64, " 16 ": 16} {
+		if got, err := parseCount(in); err != nil || got != want {
+			t.Errorf("parseCount(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "-1", "4k"} {
+		if _, err := parseCount(in); err == nil {
+			t.Errorf("parseCount(%q) did not fail", in)
+		}
+	}
+}
@@ -3,169 +3,228 @@
 package directio
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
-	"sync"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"testing"
-	"unsafe"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
-const (
-	blockSize   = 4 * 1024 // 4KB
-	commitEvery = 64       // group commit frequency
-)
-
-// --- Section: Alignment helper ---
+// The benchmarks below are configured with flags or environment variables;
+// see bench_config_test.go.
+
+// openBenchFile creates the benchmark file in the configured directory,
+// preallocated to the file size so writes measure I/O rather than block
+// allocation. Direct runs are skipped when Probe says O_DIRECT does not work
+// there or needs a coarser alignment than the block size.
+func openBenchFile(b *testing.B, c benchConfig, direct bool) (fd int, data []byte) {
+	b.Helper()
+	flags := unix.O_CREAT | unix.O_RDWR | unix.O_CLOEXEC
+	name := "buffered_wal.dat"
+	if direct {
+		cp := Probe(c.dir)
+		if !cp.Direct {
+			b.Skipf("O_DIRECT unavailable: %v", cp.Reason)
+		}
+		if c.block%cp.OffsetAlign != 0 {
+			b.Skipf("block size %d is not a multiple of the required %d", c.block, cp.OffsetAlign)
+		}
+		flags |= unix.O_DIRECT
+		name = "direct_wal.dat"
+	}
+	path := filepath.Join(c.dir, name)
+	fd, err := unix.Open(path, flags, 0o644)
+	if err != nil {
+		b.Fatalf("open %s: %v", path, err)
+	}
+	b.Cleanup(func() {
+		unix.Close(fd)
+		os.Remove(path)
+	})
+	err = unix.Fallocate(fd, 0, 0, c.fileSize)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		err = unix.Ftruncate(fd, c.fileSize)
+	}
+	if err != nil {
+		b.Fatalf("preallocate %s: %v", path, err)
+	}
 
-func aligned(size int) []byte {
-	mem := make([]byte, size+4095)
-	ptr := uintptr(unsafe.Pointer(&mem[0]))
-	offset := int(ptr & 4095)
-	start := (4096 - offset) & 4095
-	return mem[start : start+size]
+	data = Aligned(c.block)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return fd, data
 }
 
-// --- Section: Buffered I/O ---
-
-var (
-	bufOnce sync.Once
-	bufFile *os.File
-	bufData []byte
-)
-
-func setupBuffered(b *testing.B) {
-	bufOnce.Do(func() {
-		var err error
-		bufData = make([]byte, blockSize)
-
-		bufFile, err = os.OpenFile("/tmp/buffered_wal.dat",
-			os.O_CREATE|os.O_RDWR, 0o644)
+// runWrites does b.N writes of data at the configured offsets, with an
+// fdatasync after writes 0, commit, 2*commit, ... as the original benchmark
+// did, and returns how long each commit took from the write after the
+// previous fdatasync until its own fdatasync returned.
+func runWrites(b *testing.B, fd int, data []byte, c benchConfig, commit int) []time.Duration {
+	blocks := c.fileSize / int64(c.block)
+	rng := rand.New(rand.NewPCG(1, 2))
+	var lat []time.Duration
+	if commit > 0 {
+		lat = make([]time.Duration, 0, b.N/commit+1)
+	}
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		var blk int64
+		switch c.offsets {
+		case "seq":
+			blk = int64(i) % blocks
+		case "random":
+			blk = rng.Int64N(blocks)
+		}
+		n, err := unix.Pwrite(fd, data, blk*int64(c.block))
 		if err != nil {
-			b.Fatalf("open buffered: %v", err)
+			b.Fatalf("pwrite: %v", err)
+		}
+		if n != len(data) {
+			b.Fatalf("short write: %d", n)
 		}
-	})
-}
-
-func BenchmarkBufferedWrite(b *testing.B) {
-	setupBuffered(b)
-	b.SetBytes(blockSize)
-	b.ResetTimer()
 
-	for i := 0; i < b.N; i++ {
-		if _, err := bufFile.WriteAt(bufData, 0); err != nil {
-			b.Fatalf("WriteAt: %v", err)
+		if commit > 0 && i%commit == 0 {
+			if err := unix.Fdatasync(fd); err != nil {
+				b.Fatalf("fdatasync: %v", err)
+			}
+			now := time.Now()
+			lat = append(lat, now.Sub(start))
+			start = now
 		}
 	}
-	b.StopTimer()
+	return lat
 }
 
-// --- Section: Buffered + sync (group commit) ---
+// percentile returns the p-th percentile of lat, sorting it in place.
+func percentile(lat []time.Duration, p float64) time.Duration {
+	if len(lat) == 0 {
+		return 0
+	}
+	slices.Sort(lat)
+	return lat[int(float64(len(lat)-1)*p)]
+}
 
-func BenchmarkBufferedWriteSync(b *testing.B) {
-	setupBuffered(b)
-	b.SetBytes(blockSize)
+func benchWrite(b *testing.B, direct, sync bool) {
+	c := loadBenchConfig(b)
+	commit := 0
+	if sync {
+		commit = c.commit
+	}
+	fd, data := openBenchFile(b, c, direct)
+	b.SetBytes(int64(c.block))
 	b.ResetTimer()
 
-	for i := 0; i < b.N; i++ {
-		if _, err := bufFile.WriteAt(bufData, 0); err != nil {
-			b.Fatalf("WriteAt: %v", err)
-		}
-
-		if i%commitEvery == 0 {
-			if err := bufFile.Sync(); err != nil {
-				b.Fatalf("Sync: %v", err)
-			}
-		}
-	}
+	lat := runWrites(b, fd, data, c, commit)
 
 	b.StopTimer()
+	if len(lat) > 0 {
+		b.ReportMetric(float64(percentile(lat, 0.50).Microseconds()), "p50-commit-µs")
+		b.ReportMetric(float64(percentile(lat, 0.99).Microseconds()), "p99-commit-µs")
+	}
 }
 
-// --- Section: O_DIRECT I/O ---
+// --- Section: Buffered I/O ---
 
-var (
-	dirOnce sync.Once
-	dirFD   int
-	dirData []byte
-)
+func BenchmarkBufferedWrite(b *testing.B) { benchWrite(b, false, false) }
 
-func setupDirect(b *testing.B) {
-	dirOnce.Do(func() {
-		var err error
-		dirData = aligned(blockSize)
+// --- Section: Buffered + sync (group commit) ---
 
-		dirFD, err = unix.Open(
-			"/tmp/direct_wal.dat",
-			unix.O_CREAT|unix.O_WRONLY|unix.O_DIRECT,
-			0o644,
-		)
-		if err != nil {
-			b.Fatalf("open direct: %v", err)
-		}
+func BenchmarkBufferedWriteSync(b *testing.B) { benchWrite(b, false, true) }
 
-		// Optional: preallocate to avoid metadata work
-		// _ = unix.Fallocate(dirFD, 0, 0, blockSize)
-	})
-}
+// --- Section: O_DIRECT I/O ---
 
-func BenchmarkDirectWrite(b *testing.B) {
-	setupDirect(b)
-	b.SetBytes(blockSize)
-	b.ResetTimer()
+func BenchmarkDirectWrite(b *testing.B) { benchWrite(b, true, false) }
 
-	for i := 0; i < b.N; i++ {
-		n, err := unix.Pwrite(dirFD, dirData, 0)
-		if err != nil {
-			b.Fatalf("Pwrite: %v", err)
-		}
-		if n != blockSize {
-			b.Fatalf("short write: %d", n)
-		}
-	}
+// --- Section: Direct + sync (fdatasync group commit) ---
 
-	b.StopTimer()
-}
+func BenchmarkDirectWriteSync(b *testing.B) { benchWrite(b, true, true) }
 
-// --- Section: Direct + sync (fdatasync group commit) ---
+// --- Section: Sweep ---
 
-func BenchmarkDirectWriteSync(b *testing.B) {
-	setupDirect(b)
-	b.SetBytes(blockSize)
-	b.ResetTimer()
+type sweepRow struct {
+	mode, offsets string
+	block, commit int
+	mbps          float64
+	perWrite      time.Duration
+	p50, p99      time.Duration
+}
 
-	for i := 0; i < b.N; i++ {
-		n, err := unix.Pwrite(dirFD, dirData, 0)
-		if err != nil {
-			b.Fatalf("Pwrite: %v", err)
-		}
-		if n != blockSize {
-			b.Fatalf("short write: %d", n)
-		}
+// BenchmarkSweep runs buffered and direct writes over every combination of
+// offsets, -sweep.blocks and -sweep.commits in the configured directory and
+// prints a table of the results. It only runs with -sweep.
+func BenchmarkSweep(b *testing.B) {
+	if !*sweep {
+		b.Skip("run with -sweep or DIRECTIO_SWEEP=1")
+	}
+	base := loadBenchConfig(b)
+	blocks, err := parseList(*sweepBlocks, parseSize)
+	if err != nil {
+		b.Fatalf("-sweep.blocks: %v", err)
+	}
+	commits, err := parseList(*sweepCommits, parseCount)
+	if err != nil {
+		b.Fatalf("-sweep.commits: %v", err)
+	}
 
-		if i%commitEvery == 0 {
-			if err := unix.Fdatasync(dirFD); err != nil {
-				b.Fatalf("fdatasync: %v", err)
+	var rows []sweepRow
+	for _, direct := range []bool{false, true} {
+		mode := "buffered"
+		if direct {
+			mode = "direct"
+		}
+		for _, offsets := range offsetPatterns {
+			for _, block := range blocks {
+				for _, commit := range commits {
+					c := base.withBlock(b, int(block))
+					c.offsets = offsets
+					var row sweepRow
+					b.Run(fmt.Sprintf("%s/%s/block=%d/commit=%d", mode, c.offsets, c.block, commit), func(b *testing.B) {
+						fd, data := openBenchFile(b, c, direct)
+						b.SetBytes(int64(c.block))
+						b.ResetTimer()
+						start := time.Now()
+						lat := runWrites(b, fd, data, c, commit)
+						elapsed := time.Since(start)
+						b.StopTimer()
+
+						// the last call has the largest b.N and is the one reported
+						row = sweepRow{
+							mode: mode, offsets: c.offsets, block: c.block, commit: commit,
+							mbps:     float64(b.N) * float64(c.block) / elapsed.Seconds() / (1 << 20),
+							perWrite: elapsed / time.Duration(b.N),
+							p50:      percentile(lat, 0.50),
+							p99:      percentile(lat, 0.99),
+						}
+					})
+					if row.mode != "" { // empty when skipped
+						rows = append(rows, row)
+					}
+				}
 			}
 		}
 	}
-
-	b.StopTimer()
+	printSweep(os.Stdout, base, rows)
 }
 
-// --- Section: Cleanup ---
-
-func TestMain(m *testing.M) {
-	code := m.Run()
-
-	if bufFile != nil {
-		_ = bufFile.Close()
-		_ = os.Remove("/tmp/buffered_wal.dat")
-	}
-	if dirFD != 0 {
-		_ = unix.Close(dirFD)
-		_ = os.Remove("/tmp/direct_wal.dat")
+func printSweep(w io.Writer, c benchConfig, rows []sweepRow) {
+	fmt.Fprintf(w, "\n%s, file size %d MiB\n\n", c.dir, c.fileSize>>20)
+	fmt.Fprintln(w, "| mode     | offsets | block   | commit every | MiB/s   | per write | p50 commit | p99 commit |")
+	fmt.Fprintln(w, "|----------|---------|--------:|-------------:|--------:|----------:|-----------:|-----------:|")
+	for _, r := range rows {
+		commit, p50, p99 := "never", "-", "-"
+		if r.commit > 0 {
+			commit = strconv.Itoa(r.commit)
+			p50, p99 = r.p50.Round(time.Microsecond).String(), r.p99.Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(w, "| %-8s | %-7s | %7d | %12s | %7.1f | %9s | %10s | %10s |\n",
+			r.mode, r.offsets, r.block, commit, r.mbps, r.perWrite.Round(10*time.Nanosecond), p50, p99)
 	}
-
-	os.Exit(code)
 }
@@ -0,0 +1,123 @@
+//go:build linux
+
+package directio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// writeReadFile writes a synced file of the configured size for the read
+// benchmarks.
+func writeReadFile(b *testing.B, c benchConfig) string {
+	b.Helper()
+	path := filepath.Join(c.dir, "read_wal.dat")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.Remove(path) })
+	buf := testData(1 << 20)
+	for off := int64(0); off < c.fileSize; off += int64(len(buf)) {
+		if _, err := f.Write(buf[:min(int64(len(buf)), c.fileSize-off)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		b.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// setPageCache evicts the file from the page cache (its pages are clean, so
+// no privileges are needed) or, with warm, reads it all into it.
+func setPageCache(b *testing.B, path string, warm bool) {
+	b.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	if warm {
+		if _, err := io.Copy(io.Discard, f); err != nil {
+			b.Fatal(err)
+		}
+		return
+	}
+	if err := unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkRead scans a file BlockSize page by page, like WAL replay: through
+// the page cache, and with O_DIRECT through an AlignedReader with and without
+// readahead, each with a cold and a warm page cache. The file lives in the
+// configured directory and has the configured size (see bench_config_test.go).
+func BenchmarkRead(b *testing.B) {
+	c := loadBenchConfig(b)
+	path := writeReadFile(b, c)
+	type reader struct {
+		name   string
+		direct bool
+		opts   ReaderOptions
+	}
+	readers := []reader{{name: "buffered"}}
+	for _, chunk := range []int{256 << 10, 1 << 20} {
+		for _, ahead := range []bool{false, true} {
+			readers = append(readers, reader{
+				name:   fmt.Sprintf("direct/chunk=%dK/readahead=%v", chunk>>10, ahead),
+				direct: true,
+				opts:   ReaderOptions{ChunkSize: chunk, Readahead: ahead},
+			})
+		}
+	}
+
+	for _, rd := range readers {
+		for _, warm := range []bool{false, true} {
+			cache := "cold"
+			if warm {
+				cache = "warm"
+			}
+			b.Run(rd.name+"/"+cache, func(b *testing.B) {
+				f, err := OS.OpenFile(path, false, rd.direct)
+				if err != nil {
+					b.Skipf("open: %v", err)
+				}
+				defer f.Close()
+				var r io.ReaderAt = f
+				if rd.direct {
+					ar, err := NewAlignedReader(f, rd.opts)
+					if err != nil {
+						b.Fatal(err)
+					}
+					defer ar.Close()
+					r = ar
+				}
+				page := make([]byte, BlockSize)
+				b.SetBytes(c.fileSize)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					setPageCache(b, path, warm)
+					if ar, ok := r.(*AlignedReader); ok {
+						ar.Close() // start every pass without chunks in memory
+					}
+					b.StartTimer()
+					for off := int64(0); off < c.fileSize; off += BlockSize {
+						if _, err := r.ReadAt(page, off); err != nil && err != io.EOF {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
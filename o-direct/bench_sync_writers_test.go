@@ -0,0 +1,234 @@
+//go:build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirectTemp opens an O_DIRECT file in dir, a directory of its own,
+// skipping when the filesystem rejects O_DIRECT. Tests pass t.TempDir(),
+// benchmarks benchTempDir(b) so they run on the -dir volume.
+func openDirectTemp(tb testing.TB, dir string) int {
+	tb.Helper()
+	fd, err := unix.Open(filepath.Join(dir, "wal.dat"), unix.O_CREAT|unix.O_RDWR|unix.O_DIRECT|unix.O_CLOEXEC, 0o644)
+	if errors.Is(err, unix.EINVAL) {
+		tb.Skipf("O_DIRECT not supported in %s", dir)
+	}
+	if err != nil {
+		tb.Fatalf("open direct: %v", err)
+	}
+	tb.Cleanup(func() { unix.Close(fd) })
+	return fd
+}
+
+// alignedBatch returns n aligned blocks, block i filled with byte i+1.
+func alignedBatch(n int) [][]byte {
+	bufs := make([][]byte, n)
+	for i := range bufs {
+		bufs[i] = Aligned(BlockSize)
+		for j := range bufs[i] {
+			bufs[i][j] = byte(i + 1)
+		}
+	}
+	return bufs
+}
+
+func newUringTest(tb testing.TB, fd int) *UringWriter {
+	tb.Helper()
+	w, err := NewUringWriter(fd, 16)
+	if errors.Is(err, ErrNoUring) {
+		tb.Skip(err)
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { w.Close() })
+	return w
+}
+
+func testSyncWriter(t *testing.T, fd int, w SyncWriter) {
+	// 40 blocks do not fit one 16-entry ring submission
+	bufs := alignedBatch(40)
+	if err := w.WriteSync(bufs, BlockSize); err != nil {
+		t.Fatalf("WriteSync: %v", err)
+	}
+	got := Aligned(len(bufs) * BlockSize)
+	if _, err := unix.Pread(fd, got, BlockSize); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Join(bufs, nil)) {
+		t.Fatal("file does not hold the batch")
+	}
+}
+
+func TestPwriteWriter(t *testing.T) {
+	fd := openDirectTemp(t, t.TempDir())
+	testSyncWriter(t, fd, PwriteWriter{fd})
+}
+
+func TestUringWriter(t *testing.T) {
+	for _, linked := range []bool{false, true} {
+		t.Run(fmt.Sprintf("linked=%v", linked), func(t *testing.T) {
+			fd := openDirectTemp(t, t.TempDir())
+			w := newUringTest(t, fd)
+			w.Linked = linked
+			testSyncWriter(t, fd, w)
+
+			f, err := os.Open(os.DevNull) // read-only: writes fail with EBADF
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			w = newUringTest(t, int(f.Fd()))
+			w.Linked = linked
+			if err := w.WriteSync(alignedBatch(2), 0); !errors.Is(err, unix.EBADF) {
+				t.Fatalf("WriteSync on a read-only file: %v, want EBADF", err)
+			}
+
+			// no buffers is still a commit: a pipe cannot be fdatasynced
+			var p [2]int
+			if err := unix.Pipe(p[:]); err != nil {
+				t.Fatal(err)
+			}
+			defer unix.Close(p[0])
+			defer unix.Close(p[1])
+			w = newUringTest(t, p[1])
+			if err := w.WriteSync(nil, 0); !errors.Is(err, unix.EINVAL) {
+				t.Fatalf("WriteSync(nil) on a pipe: %v, want EINVAL from fdatasync", err)
+			}
+		})
+	}
+}
+
+func TestPwritevWriter(t *testing.T) {
+	for name, flags := range map[string]int{
+		"plain":  0,
+		"dsync":  unix.RWF_DSYNC,
+		"nowait": unix.RWF_NOWAIT,
+	} {
+		t.Run(name, func(t *testing.T) {
+			fd := openDirectTemp(t, t.TempDir())
+			if flags&unix.RWF_NOWAIT != 0 {
+				// allocated blocks: the write needs no allocation and does not block
+				if err := unix.Fallocate(fd, 0, 0, 64*BlockSize); err != nil {
+					t.Skip(err)
+				}
+			}
+			if _, err := unix.Pwritev2(fd, [][]byte{Aligned(BlockSize)}, 0, flags); err != nil {
+				t.Skipf("pwritev2 with flags %#x: %v", flags, err)
+			}
+			testSyncWriter(t, fd, PwritevWriter{FD: fd, Flags: flags})
+		})
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "wal.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd := int(f.Fd())
+	testSyncWriter(t, fd, &WriteBehind{FD: fd, Chunk: 4 * BlockSize})
+
+	// a stream of odd-sized writes crossing many chunks, then again from the start
+	w := &WriteBehind{FD: fd, Chunk: 3 * BlockSize}
+	var want []byte
+	for pass := range 2 {
+		w.Off, want = 0, want[:0]
+		for i := range 200 {
+			b := bytes.Repeat([]byte{byte(pass*200 + i)}, 1+i*37%700)
+			if _, err := w.Write(b); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			want = append(want, b...)
+		}
+		if err := w.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(want))
+		if _, err := f.ReadAt(got, 0); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("pass %d: file does not hold the writes", pass)
+		}
+	}
+}
+
+// --- Section: Benchmarks ---
+
+var batchSizes = []int{1, 16, 64}
+
+func benchSyncWriter(b *testing.B, newWriter func(b *testing.B, fd int) SyncWriter) {
+	for _, n := range batchSizes {
+		b.Run(fmt.Sprintf("blocks=%d", n), func(b *testing.B) {
+			fd := openDirectTemp(b, benchTempDir(b))
+			w := newWriter(b, fd)
+			bufs := alignedBatch(n)
+			b.SetBytes(int64(n * BlockSize))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// rewrite the same region: measures the commit path, not allocation
+				if err := w.WriteSync(bufs, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCommitPwrite(b *testing.B) {
+	benchSyncWriter(b, func(b *testing.B, fd int) SyncWriter { return PwriteWriter{fd} })
+}
+
+// BenchmarkCommitVectored compares the synchronous commit paths on one file:
+// a pwrite per block plus fdatasync, one pwritev2 plus fdatasync, and one
+// pwritev2 with RWF_DSYNC.
+func BenchmarkCommitVectored(b *testing.B) {
+	fd := openDirectTemp(b, benchTempDir(b))
+	if err := unix.Fallocate(fd, 0, 0, int64(batchSizes[len(batchSizes)-1]*BlockSize)); err != nil {
+		b.Fatal(err)
+	}
+	writers := []struct {
+		name string
+		w    SyncWriter
+	}{
+		{"pwrite+fdatasync", PwriteWriter{fd}},
+		{"pwritev+fdatasync", PwritevWriter{FD: fd}},
+		{"pwritev2+dsync", PwritevWriter{FD: fd, Flags: unix.RWF_DSYNC}},
+	}
+	for _, n := range batchSizes {
+		bufs := alignedBatch(n)
+		for _, w := range writers {
+			b.Run(fmt.Sprintf("%s/blocks=%d", w.name, n), func(b *testing.B) {
+				b.SetBytes(int64(n * BlockSize))
+				for i := 0; i < b.N; i++ {
+					if err := w.w.WriteSync(bufs, 0); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCommitUringLinked(b *testing.B) {
+	benchSyncWriter(b, func(b *testing.B, fd int) SyncWriter {
+		w := newUringTest(b, fd)
+		w.Linked = true
+		return w
+	})
+}
+
+func BenchmarkCommitUringDrain(b *testing.B) {
+	benchSyncWriter(b, func(b *testing.B, fd int) SyncWriter { return newUringTest(b, fd) })
+}
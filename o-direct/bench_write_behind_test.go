@@ -0,0 +1,88 @@
+//go:build linux
+
+package directio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// BenchmarkWriteBehind appends blocks to a buffered file with an fdatasync
+// every commit blocks: once with plain pwrite, where each fdatasync writes
+// back everything since the previous one, and once through WriteBehind. It
+// reports the latency distribution of single writes (a write at a commit
+// point includes the fdatasync) and of commits. Sizes and directory come from
+// bench_config_test.go; commit intervals are -commit and 16 times that.
+func BenchmarkWriteBehind(b *testing.B) {
+	c := loadBenchConfig(b)
+	for _, commit := range []int{c.commit, 16 * c.commit} {
+		if commit == 0 {
+			continue
+		}
+		for _, mode := range []struct {
+			name   string
+			behind bool  // write through WriteBehind instead of plain pwrite
+			chunk  int64 // WriteBehind.Chunk
+		}{
+			{"pwrite+fdatasync", false, 0},
+			{"write-behind/chunk=256K", true, 256 << 10},
+			{"write-behind/chunk=1024K", true, 1 << 20},
+		} {
+			b.Run(fmt.Sprintf("%s/commit=%d", mode.name, commit), func(b *testing.B) {
+				fd, data := openBenchFile(b, c, false)
+				// plain pwrite uses only Off and Commit
+				w := &WriteBehind{FD: fd, Chunk: mode.chunk}
+				write := func() error {
+					if w.Off+int64(len(data)) > c.fileSize {
+						w.Off = 0
+					}
+					if mode.behind {
+						_, err := w.Write(data)
+						return err
+					}
+					_, err := unix.Pwrite(fd, data, w.Off)
+					w.Off += int64(len(data))
+					return err
+				}
+
+				ops := make([]time.Duration, 0, b.N)
+				commits := make([]time.Duration, 0, b.N/commit+1)
+				b.SetBytes(int64(len(data)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					start := time.Now()
+					if err := write(); err != nil {
+						b.Fatalf("write: %v", err)
+					}
+					if i%commit == commit-1 {
+						cs := time.Now()
+						if err := w.Commit(); err != nil {
+							b.Fatalf("fdatasync: %v", err)
+						}
+						commits = append(commits, time.Since(cs))
+					}
+					ops = append(ops, time.Since(start))
+				}
+				b.StopTimer()
+				reportLatency(b, "write", ops)
+				reportLatency(b, "commit", commits)
+			})
+		}
+	}
+}
+
+// reportLatency reports the p50, p99, p99.9 and max of lat in µs.
+func reportLatency(b *testing.B, what string, lat []time.Duration) {
+	if len(lat) == 0 {
+		return
+	}
+	for _, q := range []struct {
+		name string
+		p    float64
+	}{{"p50", 0.50}, {"p99", 0.99}, {"p99.9", 0.999}, {"max", 1}} {
+		b.ReportMetric(float64(percentile(lat, q.p))/1e3, what+"-"+q.name+"-µs")
+	}
+}
@@ -0,0 +1,245 @@
+// Package crashfs is an in-memory directio.FS that simulates power loss.
+//
+// It remembers which writes and size changes a file Sync made durable and
+// which creates and removes a SyncDir made durable. Crash returns the
+// filesystem as the disk could look after losing power at that moment: the
+// directory as of the last SyncDir, and every file as of its last Sync plus
+// each later write dropped, applied, or torn at sector granularity.
+package crashfs
+
+import (
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+)
+
+type FS struct {
+	mu         sync.Mutex
+	sectorSize int
+	names      map[string]*inode // what the program sees
+	durable    map[string]*inode // directory entries as of the last SyncDir
+	readErr    error             // returned by every ReadAt, see FailReads
+}
+
+type inode struct {
+	data    []byte // what reads see
+	synced  []byte // contents as of the last Sync
+	pending []op   // since the last Sync, in order
+}
+
+// op is a write, or a size change when data is nil.
+type op struct {
+	off  int64
+	data []byte
+}
+
+var _ directio.FS = (*FS)(nil)
+
+// New returns an empty filesystem whose device writes sectors of sectorSize
+// bytes atomically. Files opened for direct I/O reject writes not aligned to it.
+func New(sectorSize int) *FS {
+	return &FS{sectorSize: sectorSize, names: map[string]*inode{}, durable: map[string]*inode{}}
+}
+
+func (c *FS) OpenFile(name string, create, direct bool) (directio.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name = filepath.Clean(name)
+	ino, ok := c.names[name]
+	switch {
+	case create && ok:
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case create:
+		ino = &inode{}
+		c.names[name] = ino
+	case !ok:
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &file{fs: c, ino: ino, direct: direct}, nil
+}
+
+func (c *FS) Remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := c.names[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(c.names, name)
+	return nil
+}
+
+func (c *FS) List(dir string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir = filepath.Clean(dir)
+	var out []string
+	for name := range c.names {
+		if filepath.Dir(name) == dir {
+			out = append(out, filepath.Base(name))
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// FailReads makes every ReadAt fail with err, standing in for a device
+// returning EIO, until it is called again with nil.
+func (c *FS) FailReads(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readErr = err
+}
+
+// MkdirAll does nothing: directories exist implicitly.
+func (c *FS) MkdirAll(dir string) error { return nil }
+
+func (c *FS) SyncDir(dir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir = filepath.Clean(dir)
+	for name := range c.durable {
+		if filepath.Dir(name) == dir && c.names[name] == nil {
+			delete(c.durable, name)
+		}
+	}
+	for name, ino := range c.names {
+		if filepath.Dir(name) == dir {
+			c.durable[name] = ino
+		}
+	}
+	return nil
+}
+
+// Crash returns what survives a power loss now. The receiver is left as is,
+// so writers still using it can be shut down afterwards.
+func (c *FS) Crash(rng *rand.Rand) *FS {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := New(c.sectorSize)
+	for name, ino := range c.durable {
+		img := ino.crash(rng, c.sectorSize)
+		survivor := &inode{data: img, synced: slices.Clone(img)}
+		out.names[name], out.durable[name] = survivor, survivor
+	}
+	return out
+}
+
+// crash applies each unsynced op to the synced contents completely, not at
+// all, or sector by sector at random.
+func (ino *inode) crash(rng *rand.Rand, sector int) []byte {
+	img := slices.Clone(ino.synced)
+	for _, o := range ino.pending {
+		mode := rng.IntN(3) // 0 drop, 1 apply, 2 tear
+		if mode == 0 {
+			continue
+		}
+		if o.data == nil {
+			img = resize(img, o.off)
+			continue
+		}
+		end := o.off + int64(len(o.data))
+		for pos := o.off; pos < end; {
+			next := min(end, (pos/int64(sector)+1)*int64(sector))
+			if mode == 1 || rng.IntN(2) == 0 {
+				if int64(len(img)) < next {
+					img = resize(img, next)
+				}
+				copy(img[pos:next], o.data[pos-o.off:next-o.off])
+			}
+			pos = next
+		}
+	}
+	return img
+}
+
+func resize(b []byte, size int64) []byte {
+	if int64(len(b)) >= size {
+		return b[:size]
+	}
+	return append(b, make([]byte, size-int64(len(b)))...)
+}
+
+type file struct {
+	fs     *FS
+	ino    *inode
+	direct bool
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.fs.readErr != nil {
+		return 0, f.fs.readErr
+	}
+	if off >= int64(len(f.ino.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.ino.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	ss := f.fs.sectorSize
+	if f.direct && len(p) > 0 && (off%int64(ss) != 0 || len(p)%ss != 0 || uintptr(unsafe.Pointer(&p[0]))%uintptr(ss) != 0) {
+		return 0, syscall.EINVAL
+	}
+	if len(p) == 0 {
+		// like pwrite: no change, not even to the size; an op with nil data would be a truncate
+		return 0, nil
+	}
+	end := off + int64(len(p))
+	if int64(len(f.ino.data)) < end {
+		f.ino.data = resize(f.ino.data, end)
+	}
+	copy(f.ino.data[off:], p)
+	f.ino.pending = append(f.ino.pending, op{off, slices.Clone(p)})
+	return len(p), nil
+}
+
+func (f *file) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.ino.synced = slices.Clone(f.ino.data)
+	f.ino.pending = nil
+	return nil
+}
+
+func (f *file) Size() (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return int64(len(f.ino.data)), nil
+}
+
+func (f *file) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.ino.data = resize(f.ino.data, size)
+	f.ino.pending = append(f.ino.pending, op{off: size})
+	return nil
+}
+
+func (f *file) Allocate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if int64(len(f.ino.data)) < size {
+		f.ino.data = resize(f.ino.data, size)
+		f.ino.pending = append(f.ino.pending, op{off: size})
+	}
+	return nil
+}
+
+func (f *file) Close() error { return nil }
@@ -0,0 +1,141 @@
+package crashfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"syscall"
+	"testing"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+)
+
+const sector = 512
+
+func create(t *testing.T, c *FS, name string, direct bool) directio.File {
+	t.Helper()
+	f, err := c.OpenFile(name, true, direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func contents(t *testing.T, c *FS, name string) []byte {
+	t.Helper()
+	f, err := c.OpenFile(name, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _ := f.Size()
+	b := make([]byte, size)
+	if size > 0 {
+		if _, err := f.ReadAt(b, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestCrashDropsOrTearsUnsyncedWrites(t *testing.T) {
+	synced := bytes.Repeat([]byte{'s'}, 4*sector)
+	unsynced := bytes.Repeat([]byte{'u'}, 4*sector)
+	seen := map[string]bool{}
+	for seed := range uint64(64) {
+		c := New(sector)
+		f := create(t, c, "d/log", false)
+		f.WriteAt(synced, 0)
+		f.Sync()
+		c.SyncDir("d")
+		f.WriteAt(unsynced, 0)
+
+		got := contents(t, c.Crash(rand.New(rand.NewPCG(seed, 0))), "d/log")
+		if len(got) != len(synced) {
+			t.Fatalf("size %d after crash, want %d", len(got), len(synced))
+		}
+		kind := ""
+		for i := 0; i < len(got); i += sector {
+			s := got[i : i+sector]
+			if !bytes.Equal(s, synced[:sector]) && !bytes.Equal(s, unsynced[:sector]) {
+				t.Fatalf("sector %d is torn inside: %q", i/sector, s)
+			}
+			kind += string(s[0])
+		}
+		seen[kind] = true
+	}
+	for _, want := range []string{"ssss", "uuuu"} {
+		if !seen[want] {
+			t.Errorf("no crash left %s", want)
+		}
+	}
+	if len(seen) < 3 {
+		t.Errorf("no torn writes in 64 crashes: %v", seen)
+	}
+}
+
+func TestZeroLengthWriteChangesNothing(t *testing.T) {
+	synced := bytes.Repeat([]byte{'s'}, 4*sector)
+	for seed := range uint64(16) {
+		c := New(sector)
+		f := create(t, c, "d/log", false)
+		f.WriteAt(synced, 0)
+		f.Sync()
+		c.SyncDir("d")
+		if n, err := f.WriteAt(nil, sector); n != 0 || err != nil {
+			t.Fatalf("empty write: %d, %v", n, err)
+		}
+		f.WriteAt([]byte{}, 8*sector)
+		if got := contents(t, c, "d/log"); !bytes.Equal(got, synced) {
+			t.Fatalf("empty writes changed the file to %d bytes", len(got))
+		}
+		if got := contents(t, c.Crash(rand.New(rand.NewPCG(seed, 0))), "d/log"); !bytes.Equal(got, synced) {
+			t.Fatalf("crash after empty writes left %d bytes, want %d", len(got), len(synced))
+		}
+	}
+}
+
+func TestCrashKeepsOnlySyncedDirectory(t *testing.T) {
+	c := New(sector)
+	create(t, c, "d/a", false)
+	c.SyncDir("d")
+	create(t, c, "d/b", false)
+	if err := c.Remove("d/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	after := c.Crash(rand.New(rand.NewPCG(1, 0)))
+	if names, _ := after.List("d"); len(names) != 1 || names[0] != "a" {
+		t.Fatalf("after crash: %v, want [a]", names)
+	}
+	c.SyncDir("d")
+	after = c.Crash(rand.New(rand.NewPCG(1, 0)))
+	if names, _ := after.List("d"); len(names) != 1 || names[0] != "b" {
+		t.Fatalf("after SyncDir and crash: %v, want [b]", names)
+	}
+	if _, err := c.OpenFile("d/b", true, false); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("create existing: %v", err)
+	}
+}
+
+func TestDirectWritesMustBeAligned(t *testing.T) {
+	c := New(sector)
+	f := create(t, c, "log", true)
+	buf := directio.Aligned(directio.BlockSize)
+	if _, err := f.WriteAt(buf, 0); err != nil {
+		t.Fatalf("aligned write: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		b    []byte
+		off  int64
+	}{
+		{"offset", buf, 100},
+		{"length", buf[:100], 0},
+		{"address", buf[1 : 1+sector], 0},
+	} {
+		if _, err := f.WriteAt(tc.b, tc.off); err != syscall.EINVAL {
+			t.Errorf("unaligned %s: %v, want EINVAL", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package directio
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File is the part of a file the log writers use. On a file opened for direct
+// I/O, writes need aligned buffers, offsets and lengths.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error // fdatasync
+	Size() (int64, error)
+	Truncate(size int64) error
+	// Allocate reserves blocks up to size, growing the file to it (fallocate).
+	Allocate(size int64) error
+	Close() error
+}
+
+// FS is where the log writers keep their files. OS is the real filesystem;
+// crash tests substitute one that loses unsynced writes (see crashfs).
+type FS interface {
+	// OpenFile opens name for reading and writing. create makes a new file
+	// and fails if it exists; direct asks for O_DIRECT.
+	OpenFile(name string, create, direct bool) (File, error)
+	Remove(name string) error
+	// List returns the names of the files in dir.
+	List(dir string) ([]string, error)
+	MkdirAll(dir string) error
+	// SyncDir makes creates and removes in dir durable.
+	SyncDir(dir string) error
+}
+
+// OS is the operating system's filesystem.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, create, direct bool) (File, error) {
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE | os.O_EXCL
+	}
+	if direct {
+		flags |= oDirect
+		if oDirect == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errNoDirect}
+		}
+	}
+	f, err := os.OpenFile(name, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return osFile{f}, nil
+}
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (osFS) MkdirAll(dir string) error { return os.MkdirAll(dir, 0o755) }
+
+func (osFS) SyncDir(dir string) error {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type osFile struct{ *os.File }
+
+func (f osFile) Sync() error { return fdatasync(f.File) }
+
+func (f osFile) Size() (int64, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return st.Size(), nil
+}
+
+func (f osFile) Allocate(size int64) error { return allocate(f.File, size) }
@@ -0,0 +1,25 @@
+//go:build linux
+
+package directio
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const oDirect = unix.O_DIRECT
+
+var errNoDirect error // O_DIRECT exists on linux
+
+func fdatasync(f *os.File) error { return unix.Fdatasync(int(f.Fd())) }
+
+// allocate preallocates with fallocate; filesystems without it get a sparse
+// file of that size.
+func allocate(f *os.File, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if err == unix.EOPNOTSUPP {
+		return f.Truncate(size)
+	}
+	return err
+}
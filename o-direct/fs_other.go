@@ -0,0 +1,17 @@
+//go:build !linux
+
+package directio
+
+import (
+	"errors"
+	"os"
+)
+
+const oDirect = 0
+
+var errNoDirect = errors.New("O_DIRECT is only supported on linux")
+
+func fdatasync(f *os.File) error { return f.Sync() }
+
+// allocate sizes f; without fallocate the file is sparse.
+func allocate(f *os.File, size int64) error { return f.Truncate(size) }
@@ -1,4 +1,4 @@
-module github.com/creotiv/go-hiload
+module github.com/creotiv/go-hiload/o-direct
 
 go 1.24.2
 
@@ -0,0 +1,128 @@
+//go:build linux
+
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Capability is what direct I/O looks like for files in one directory.
+type Capability struct {
+	Direct bool // O_DIRECT open and an aligned write both worked
+
+	// Alignment O_DIRECT needs for buffer addresses and for file offsets and
+	// lengths. Taken from statx (Linux 6.1+), else from the logical block size
+	// of the device (BLKSSZGET), else BlockSize.
+	MemAlign, OffsetAlign int
+	Source                string // where the alignment came from
+
+	Reason error // why Direct is false
+}
+
+// Probe creates a scratch file in dir to find out whether O_DIRECT works
+// there and with which alignment. tmpfs (before 6.6), some overlayfs setups
+// and FUSE filesystems reject O_DIRECT with EINVAL.
+func Probe(dir string) Capability {
+	c := Capability{MemAlign: BlockSize, OffsetAlign: BlockSize, Source: "default"}
+	path := filepath.Join(dir, fmt.Sprintf(".directio-probe-%d", os.Getpid()))
+	defer os.Remove(path)
+
+	fd, err := unix.Open(path, unix.O_CREAT|unix.O_RDWR|unix.O_DIRECT|unix.O_CLOEXEC, 0o600)
+	if err != nil {
+		c.Reason = fmt.Errorf("open with O_DIRECT: %w", err)
+		return c
+	}
+	defer unix.Close(fd)
+
+	var stx unix.Statx_t
+	err = unix.Statx(fd, "", unix.AT_EMPTY_PATH, unix.STATX_DIOALIGN, &stx)
+	switch {
+	case err == nil && stx.Mask&unix.STATX_DIOALIGN != 0 && stx.Dio_offset_align == 0:
+		c.Reason = errors.New("statx: filesystem does not support direct I/O on this file")
+		return c
+	case err == nil && stx.Mask&unix.STATX_DIOALIGN != 0:
+		c.MemAlign, c.OffsetAlign, c.Source = int(stx.Dio_mem_align), int(stx.Dio_offset_align), "statx"
+	default:
+		if n, err := logicalBlockSize(fd); err == nil {
+			c.MemAlign, c.OffsetAlign, c.Source = n, n, "BLKSSZGET"
+		}
+	}
+
+	// Opening is not enough: some filesystems accept the flag and fail writes.
+	// Aligned is BlockSize-aligned, which covers every smaller requirement.
+	if c.MemAlign > BlockSize || BlockSize%c.MemAlign != 0 {
+		c.Reason = fmt.Errorf("unsupported memory alignment %d", c.MemAlign)
+		return c
+	}
+	buf := Aligned(max(c.OffsetAlign, BlockSize))
+	if _, err := unix.Pwrite(fd, buf, 0); err != nil {
+		c.Reason = fmt.Errorf("aligned O_DIRECT write: %w", err)
+		return c
+	}
+	c.Direct = true
+	return c
+}
+
+// logicalBlockSize asks the block device holding fd's file for its logical
+// sector size. Opening the device usually needs privileges.
+func logicalBlockSize(fd int) (int, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return 0, err
+	}
+	dev, err := os.Open(fmt.Sprintf("/dev/block/%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev)))
+	if err != nil {
+		return 0, err
+	}
+	defer dev.Close()
+	return unix.IoctlGetInt(int(dev.Fd()), unix.BLKSSZGET)
+}
+
+// LogFile is a log file opened the way Probe says works: O_DIRECT with a
+// SyncWriter, or buffered I/O with pwrite and fdatasync.
+type LogFile struct {
+	FD  int
+	Cap Capability // Cap.Reason says why the file is buffered
+	SyncWriter
+
+	// WriterReason says why a direct file commits with pwrite instead of
+	// io_uring, as returned by NewSyncWriter. Nil when io_uring is used or
+	// the file is buffered.
+	WriterReason error
+
+	// BlockSize is the size and alignment to use for every write.
+	BlockSize int
+}
+
+// OpenLogFile probes the directory of path and opens path to match.
+func OpenLogFile(path string) (*LogFile, error) {
+	c := Probe(filepath.Dir(path))
+	flags := unix.O_CREAT | unix.O_RDWR | unix.O_CLOEXEC
+	if c.Direct {
+		flags |= unix.O_DIRECT
+	}
+	fd, err := unix.Open(path, flags, 0o644)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	f := &LogFile{FD: fd, Cap: c, BlockSize: max(c.OffsetAlign, BlockSize)}
+	if c.Direct {
+		f.SyncWriter, f.WriterReason = NewSyncWriter(fd)
+	} else {
+		f.SyncWriter = PwriteWriter{fd}
+	}
+	return f, nil
+}
+
+func (f *LogFile) Close() error {
+	err := f.SyncWriter.Close()
+	if cerr := unix.Close(f.FD); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestProbe(t *testing.T) {
+	dir := t.TempDir()
+	c := Probe(dir)
+	t.Logf("%s: direct=%v mem=%d offset=%d source=%s reason=%v", dir, c.Direct, c.MemAlign, c.OffsetAlign, c.Source, c.Reason)
+	if c.Direct != (c.Reason == nil) {
+		t.Fatalf("Direct=%v with reason %v", c.Direct, c.Reason)
+	}
+	if c.OffsetAlign <= 0 || c.MemAlign <= 0 {
+		t.Fatalf("alignment %d/%d", c.MemAlign, c.OffsetAlign)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("probe left %d files behind", len(entries))
+	}
+}
+
+func TestProbeRejectsMissingDir(t *testing.T) {
+	c := Probe(filepath.Join(t.TempDir(), "missing"))
+	if c.Direct || c.Reason == nil {
+		t.Fatalf("probe of a missing dir: direct=%v reason=%v", c.Direct, c.Reason)
+	}
+}
+
+func TestOpenLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.dat")
+	f, err := OpenLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	flags, err := unix.FcntlInt(uintptr(f.FD), unix.F_GETFL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if direct := flags&unix.O_DIRECT != 0; direct != f.Cap.Direct {
+		t.Fatalf("O_DIRECT=%v but probe said %v (%v)", direct, f.Cap.Direct, f.Cap.Reason)
+	}
+	if _, uring := f.SyncWriter.(*UringWriter); f.Cap.Direct && uring != (f.WriterReason == nil) {
+		t.Fatalf("io_uring writer %v with fallback reason %v", uring, f.WriterReason)
+	}
+
+	bufs := [][]byte{Aligned(f.BlockSize), Aligned(f.BlockSize)}
+	bufs[0][0], bufs[1][0] = 1, 2
+	if err := f.WriteSync(bufs, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Join(bufs, nil)) {
+		t.Fatal("file does not hold the written blocks")
+	}
+}
@@ -1 +1,3 @@
-go test -bench . -benchmem
\ No newline at end of file
+# Benchmark parameters are flags after -args or DIRECTIO_* environment
+# variables, e.g. DIRECTIO_DIR=/mnt/nvme ./run.sh (see README).
+go test -bench . -benchmem "$@"
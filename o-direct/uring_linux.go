@@ -0,0 +1,297 @@
+//go:build linux
+
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoUring is returned when io_uring cannot be set up: kernels before 5.6,
+// io_uring_disabled, or a seccomp filter (Docker's default profile).
+var ErrNoUring = errors.New("io_uring unavailable")
+
+// io_uring ABI from include/uapi/linux/io_uring.h. x/sys/unix has the syscall
+// numbers but none of the types.
+const (
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringOpFsync = 3
+	ioringOpWrite = 23 // 5.6+
+
+	ioringFsyncDatasync  = 1
+	iosqeIODrain         = 1 << 1
+	iosqeIOLink          = 1 << 2
+	ioringEnterGetEvents = 1
+	ioringFeatSingleMmap = 1 << 0
+)
+
+type ioSQRingOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type ioCQRingOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type ioUringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  ioSQRingOffsets
+	cqOff                                                                  ioCQRingOffsets
+}
+
+type ioUringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32 // rw_flags / fsync_flags
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	_           uint64
+}
+
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// UringWriter commits a batch through io_uring: one write SQE per buffer and
+// an fdatasync, all submitted and reaped with a single io_uring_enter. Not
+// safe for concurrent use.
+type UringWriter struct {
+	// Linked chains the writes and the fdatasync with IOSQE_IO_LINK: they run
+	// one after another and a failed write cancels the rest. Otherwise the
+	// writes run in parallel and the fdatasync is marked IOSQE_IO_DRAIN, so it
+	// still starts only after all of them completed.
+	Linked bool
+
+	fd, ring int
+
+	sqMem, cqMem, sqeMem []byte
+	sqHead, sqTail       *uint32
+	cqHead               *uint32
+	cqTail               *uint32
+	sqMask, cqMask       uint32
+	sqArray              []uint32
+	sqes                 []ioUringSQE
+	cqes                 []ioUringCQE
+
+	err error // set when a failed call left completions in flight
+}
+
+// NewUringWriter sets up a ring with room for entries SQEs; larger batches
+// are split. Buffers passed to WriteSync must live on the heap (Aligned
+// buffers do): the kernel reads them by address.
+func NewUringWriter(fd int, entries uint32) (*UringWriter, error) {
+	var p ioUringParams
+	ring, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("%w: io_uring_setup: %v", ErrNoUring, errno)
+	}
+	w := &UringWriter{fd: fd, ring: int(ring)}
+	if err := w.mmap(&p); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("%w: %v", ErrNoUring, err)
+	}
+	return w, nil
+}
+
+func (w *UringWriter) mmap(p *ioUringParams) error {
+	const prot, flags = unix.PROT_READ | unix.PROT_WRITE, unix.MAP_SHARED | unix.MAP_POPULATE
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(ioUringCQE{})))
+	single := p.features&ioringFeatSingleMmap != 0
+	if single {
+		sqSize = max(sqSize, cqSize)
+	}
+
+	var err error
+	if w.sqMem, err = unix.Mmap(w.ring, ioringOffSQRing, sqSize, prot, flags); err != nil {
+		return err
+	}
+	w.cqMem = w.sqMem
+	if !single {
+		if w.cqMem, err = unix.Mmap(w.ring, ioringOffCQRing, cqSize, prot, flags); err != nil {
+			return err
+		}
+	}
+	sqeSize := int(p.sqEntries) * int(unsafe.Sizeof(ioUringSQE{}))
+	if w.sqeMem, err = unix.Mmap(w.ring, ioringOffSQEs, sqeSize, prot, flags); err != nil {
+		return err
+	}
+
+	u32 := func(mem []byte, off uint32) *uint32 { return (*uint32)(unsafe.Pointer(&mem[off])) }
+	w.sqHead = u32(w.sqMem, p.sqOff.head)
+	w.sqTail = u32(w.sqMem, p.sqOff.tail)
+	w.sqMask = *u32(w.sqMem, p.sqOff.ringMask)
+	w.sqArray = unsafe.Slice(u32(w.sqMem, p.sqOff.array), p.sqEntries)
+	w.sqes = unsafe.Slice((*ioUringSQE)(unsafe.Pointer(&w.sqeMem[0])), p.sqEntries)
+	w.cqHead = u32(w.cqMem, p.cqOff.head)
+	w.cqTail = u32(w.cqMem, p.cqOff.tail)
+	w.cqMask = *u32(w.cqMem, p.cqOff.ringMask)
+	w.cqes = unsafe.Slice((*ioUringCQE)(unsafe.Pointer(&w.cqMem[p.cqOff.cqes])), p.cqEntries)
+	return nil
+}
+
+// WriteSync writes bufs back to back from off and fdatasyncs the file. With
+// no bufs it only fdatasyncs.
+func (w *UringWriter) WriteSync(bufs [][]byte, off int64) error {
+	if w.err != nil {
+		return w.err
+	}
+	per := len(w.sqes) - 1 // leave room for the fdatasync
+	for {
+		n := min(len(bufs), per)
+		last := n == len(bufs)
+		if err := w.submit(bufs[:n], off, last); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		for _, b := range bufs[:n] {
+			off += int64(len(b))
+		}
+		bufs = bufs[n:]
+	}
+}
+
+// submit queues the writes, plus fdatasync when sync is set, and waits for
+// all of their completions.
+func (w *UringWriter) submit(bufs [][]byte, off int64, sync bool) error {
+	tail := *w.sqTail // only this process moves the SQ tail
+	queue := func(sqe ioUringSQE) {
+		i := tail & w.sqMask
+		w.sqes[i] = sqe
+		w.sqArray[i] = i
+		tail++
+	}
+	for i, b := range bufs {
+		sqe := ioUringSQE{
+			opcode:   ioringOpWrite,
+			fd:       int32(w.fd),
+			off:      uint64(off),
+			addr:     uint64(uintptr(unsafe.Pointer(&b[0]))),
+			len:      uint32(len(b)),
+			userData: uint64(i),
+		}
+		if w.Linked && (i < len(bufs)-1 || sync) {
+			sqe.flags = iosqeIOLink
+		}
+		queue(sqe)
+		off += int64(len(b))
+	}
+	n := len(bufs)
+	if sync {
+		sqe := ioUringSQE{opcode: ioringOpFsync, fd: int32(w.fd), opFlags: ioringFsyncDatasync, userData: uint64(n)}
+		if !w.Linked {
+			sqe.flags = iosqeIODrain
+		}
+		queue(sqe)
+		n++
+	}
+	atomic.StoreUint32(w.sqTail, tail)
+
+	// Usually one enter submits the chain and waits for all completions. The
+	// kernel may take fewer SQEs than asked; it then returns without waiting,
+	// and the rest is submitted by the next round.
+	var first error
+	toSubmit, reaped := n, 0
+	for reaped < n {
+		submitted, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(w.ring),
+			uintptr(toSubmit), uintptr(n-reaped), ioringEnterGetEvents, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			err := fmt.Errorf("io_uring_enter: %w", errno)
+			w.reset(n-toSubmit-reaped, err)
+			runtime.KeepAlive(bufs)
+			return err
+		}
+		toSubmit -= int(submitted)
+		reaped += w.reap(func(cqe ioUringCQE) {
+			if err := cqeErr(cqe, bufs); err != nil && first == nil {
+				first = err
+			}
+		})
+	}
+	runtime.KeepAlive(bufs)
+	return first
+}
+
+// reap consumes the completions in the CQ and returns how many there were.
+func (w *UringWriter) reap(f func(ioUringCQE)) int {
+	head, ctail := *w.cqHead, atomic.LoadUint32(w.cqTail)
+	n := int(ctail - head)
+	for ; head != ctail; head++ {
+		f(w.cqes[head&w.cqMask])
+	}
+	atomic.StoreUint32(w.cqHead, head)
+	return n
+}
+
+// reset leaves the ring empty after a failed io_uring_enter, so the next call
+// does not take these completions for its own: SQEs the kernel has not taken
+// are dropped and the inflight ones are waited for. If even that fails the
+// writer is unusable and every later call returns cause.
+func (w *UringWriter) reset(inflight int, cause error) {
+	atomic.StoreUint32(w.sqTail, atomic.LoadUint32(w.sqHead))
+	for inflight > 0 {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(w.ring),
+			0, uintptr(inflight), ioringEnterGetEvents, 0, 0)
+		if errno != 0 && errno != unix.EINTR {
+			w.err = fmt.Errorf("io_uring ring unusable: %w", cause)
+			return
+		}
+		inflight -= w.reap(func(ioUringCQE) {})
+	}
+}
+
+// cqeErr turns a completion into an error. Operations cancelled because an
+// earlier link failed report that earlier failure instead.
+func cqeErr(cqe ioUringCQE, bufs [][]byte) error {
+	switch {
+	case cqe.res == -int32(unix.ECANCELED):
+		return nil
+	case cqe.res < 0 && int(cqe.userData) == len(bufs):
+		return fmt.Errorf("fdatasync: %w", unix.Errno(-cqe.res))
+	case cqe.res < 0:
+		return fmt.Errorf("write: %w", unix.Errno(-cqe.res))
+	case int(cqe.userData) < len(bufs) && int(cqe.res) != len(bufs[cqe.userData]):
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+func (w *UringWriter) Close() error {
+	if w.sqeMem != nil {
+		_ = unix.Munmap(w.sqeMem)
+	}
+	if w.cqMem != nil && &w.cqMem[0] != &w.sqMem[0] {
+		_ = unix.Munmap(w.cqMem)
+	}
+	if w.sqMem != nil {
+		_ = unix.Munmap(w.sqMem)
+	}
+	return unix.Close(w.ring)
+}
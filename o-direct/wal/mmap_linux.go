@@ -0,0 +1,246 @@
+//go:build linux
+
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+	"golang.org/x/sys/unix"
+)
+
+// MmapLog is an append log in the same page format and segment files as WAL,
+// kept for comparison with it: records are copied straight into a shared
+// mapping of the preallocated segment, and Sync is msync(MS_SYNC) on the pages
+// written since the previous Sync. No batch buffer, no pwrite; the kernel
+// writes the dirty pages back. OpenReader replays it like any other log.
+//
+// As in WAL, Sync seals the page being filled and the next record starts on a
+// fresh page, so a synced page is never modified again. Until then a page in
+// the mapping may be written back at any moment, half sealed; that is
+// harmless because nothing on it was acknowledged, and the page fails its
+// checksum on replay.
+type MmapLog struct {
+	mu       sync.Mutex
+	dir      string
+	pageSize int
+	size     int64 // size of new segments
+
+	seg    segment // segment being written
+	f      *os.File
+	mem    []byte // seg mapped shared, read-write
+	page   int    // offset in mem of the page being filled
+	used   int    // payload bytes used in that page
+	cont   int    // continuation length for that page's header
+	left   int    // bytes of the record being appended not yet copied
+	synced int    // mem[:synced] is durable
+
+	tail   LSN
+	err    error // sticky, as in WAL
+	closed bool
+}
+
+// OpenMmap opens or creates the log in dir, recovering it like Open does.
+// Only opts.PageSize and opts.SegmentSize are used.
+func OpenMmap(dir string, opts Options) (*MmapLog, error) {
+	if opts.PageSize == 0 {
+		opts.PageSize = directio.BlockSize
+	}
+	if opts.PageSize%directio.BlockSize != 0 || opts.PageSize%os.Getpagesize() != 0 {
+		return nil, fmt.Errorf("wal: page size %d is not a multiple of the memory page size", opts.PageSize)
+	}
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.SegmentSize <= 0 || opts.SegmentSize%int64(opts.PageSize) != 0 {
+		return nil, fmt.Errorf("wal: segment size %d is not a multiple of the page size", opts.SegmentSize)
+	}
+	if err := directio.OS.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	segs, base, err := recoverLog(directio.OS, dir, opts.PageSize, Buffered)
+	if err != nil {
+		return nil, fmt.Errorf("wal: recover: %w", err)
+	}
+
+	l := &MmapLog{dir: dir, pageSize: opts.PageSize, size: opts.SegmentSize, tail: base}
+	if n := len(segs); n > 0 && base < segs[n-1].end() {
+		err = l.mapSegment(segs[n-1], int(base-segs[n-1].start))
+	} else {
+		err = l.newSegment(base)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	return l, nil
+}
+
+// newSegment creates the segment starting at start and maps it.
+func (l *MmapLog) newSegment(start LSN) error {
+	s, err := createSegment(directio.OS, l.dir, start, l.size)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	return l.mapSegment(s, 0)
+}
+
+// mapSegment maps s for writing from offset off, a page boundary.
+func (l *MmapLog) mapSegment(s segment, off int) error {
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	mem, err := unix.Mmap(int(f.Fd()), 0, int(s.size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("mmap %s: %w", s.path, err)
+	}
+	l.seg, l.f, l.mem = s, f, mem
+	l.page, l.used, l.synced = off, 0, off
+	return nil
+}
+
+// unmap syncs what is left of the segment and unmaps it.
+func (l *MmapLog) unmap() error {
+	err := l.msync()
+	if uerr := unix.Munmap(l.mem); err == nil {
+		err = uerr
+	}
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.mem, l.f = nil, nil
+	return err
+}
+
+// Append adds a record and returns its LSN. The record is durable once a
+// later Sync returns.
+func (l *MmapLog) Append(data []byte) (LSN, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	if l.payloadCap()-l.used < recordHeaderSize {
+		if err := l.nextPage(); err != nil {
+			return 0, err
+		}
+	}
+	lsn := l.pos()
+	binary.LittleEndian.PutUint32(l.mem[l.page+pageHeaderSize+l.used:], uint32(len(data)))
+	l.used += recordHeaderSize
+
+	l.left = len(data)
+	for {
+		n := copy(l.mem[l.page+pageHeaderSize+l.used:l.page+l.pageSize], data[len(data)-l.left:])
+		l.used += n
+		l.left -= n
+		if l.left == 0 {
+			break
+		}
+		if err := l.nextPage(); err != nil {
+			return 0, err
+		}
+	}
+	l.tail = l.pos()
+	if l.used == l.payloadCap() {
+		if err := l.nextPage(); err != nil {
+			return 0, err
+		}
+	}
+	return lsn, nil
+}
+
+func (l *MmapLog) payloadCap() int { return l.pageSize - pageHeaderSize }
+
+// pos is the LSN of the next free payload byte.
+func (l *MmapLog) pos() LSN {
+	return l.seg.start + LSN(l.page) + pageHeaderSize + LSN(l.used)
+}
+
+// nextPage seals the page being filled and moves to the next one. At the end
+// of the segment the segment is synced and the next one mapped.
+func (l *MmapLog) nextPage() error {
+	sealPage(l.mem[l.page:l.page+l.pageSize], l.seg.start+LSN(l.page), l.used, l.cont)
+	l.page += l.pageSize
+	l.used = 0
+	l.cont = l.left
+	if l.page < len(l.mem) {
+		return nil
+	}
+	next := l.seg.end()
+	if err := l.unmap(); err != nil {
+		l.err = fmt.Errorf("wal: %w", err)
+		return l.err
+	}
+	if err := l.newSegment(next); err != nil {
+		l.err = fmt.Errorf("wal: %w", err)
+		return l.err
+	}
+	return nil
+}
+
+// Sync makes every record appended so far durable.
+func (l *MmapLog) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	return l.sync()
+}
+
+func (l *MmapLog) sync() error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.used > 0 {
+		// seal the partial page; the next record starts on a fresh one
+		l.left = 0
+		if err := l.nextPage(); err != nil {
+			return err
+		}
+	}
+	if err := l.msync(); err != nil {
+		l.err = fmt.Errorf("wal: %w", err)
+		return l.err
+	}
+	return nil
+}
+
+// msync writes back and syncs the sealed pages not synced yet. On Linux
+// msync(MS_SYNC) on a shared file mapping ends in fsync of that range.
+func (l *MmapLog) msync() error {
+	if l.page == l.synced {
+		return nil
+	}
+	if err := unix.Msync(l.mem[l.synced:l.page], unix.MS_SYNC); err != nil {
+		return fmt.Errorf("msync: %w", err)
+	}
+	l.synced = l.page
+	return nil
+}
+
+// Close makes pending records durable and unmaps the log.
+func (l *MmapLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	l.closed = true
+	err := l.sync()
+	if l.mem != nil {
+		if uerr := l.unmap(); err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
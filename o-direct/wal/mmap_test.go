@@ -0,0 +1,50 @@
+//go:build linux
+
+package wal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMmapLogReplaysWithReader(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{SegmentSize: 4 * 4096} // records cross segments
+	var want []record
+	for round := range 2 { // the second round appends after recovery
+		l, err := OpenMmap(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 30 {
+			data := bytes.Repeat([]byte{byte(round*30 + i)}, 1+i*397%9000)
+			lsn, err := l.Append(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, record{lsn, data})
+			if i%7 == 6 {
+				if err := l.Sync(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, r := readAll(t, dir)
+	defer r.Close()
+	if err := r.Err(); err != nil {
+		t.Fatalf("replay stopped at damage: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("replayed %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].lsn != want[i].lsn || !bytes.Equal(got[i].data, want[i].data) {
+			t.Fatalf("record %d: lsn %d (%d bytes), want lsn %d (%d bytes)", i, got[i].lsn, len(got[i].data), want[i].lsn, len(want[i].data))
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Page layout (little endian), pageHeaderSize bytes of header then payload:
+//
+//	0   magic   uint32  pageMagic
+//	4   crc     uint32  CRC32C of bytes [8, pageHeaderSize+length)
+//	8   lsn     uint64  LSN of the first byte of the page
+//	16  length  uint32  payload bytes in use; the rest of the page is zero padding
+//	20  cont    uint32  bytes of a record started on an earlier page that
+//	                    continue at the start of this payload (0 if none)
+//
+// The payload is a stream of records, each a uint32 length and the bytes.
+// A record continues onto the next page only when its page is full, so a page
+// with length < capacity always ends on a record boundary.
+//
+// A crash can leave a page that was never written (zeros: bad magic), written
+// only partly at sector granularity (torn: bad CRC) or left over from an
+// earlier use of the file (stale: wrong LSN). All three stop a reader.
+//
+// Recovery truncates the log after the last valid record, so the first page
+// written afterwards can follow a page whose last record was cut off. That
+// page has cont 0 where a continuation was expected; only recovery produces
+// this, and the reader drops the cut record and goes on with the new page.
+const (
+	pageHeaderSize = 24
+	pageMagic      = 0x314c4157 // "WAL1"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	ErrBadMagic    = errors.New("wal: bad page magic")
+	ErrChecksum    = errors.New("wal: page checksum mismatch")
+	ErrLSNMismatch = errors.New("wal: page LSN does not match its position")
+	ErrBadLength   = errors.New("wal: page length out of range")
+	ErrContinuity  = errors.New("wal: record continuation does not match previous page")
+)
+
+// PageError reports why the page at LSN failed validation.
+type PageError struct {
+	LSN LSN
+	Err error
+}
+
+func (e *PageError) Error() string { return fmt.Sprintf("page at %d: %v", e.LSN, e.Err) }
+func (e *PageError) Unwrap() error { return e.Err }
+
+// sealPage fills the header of page for a payload of length bytes.
+func sealPage(page []byte, lsn LSN, length, cont int) {
+	binary.LittleEndian.PutUint32(page[0:], pageMagic)
+	binary.LittleEndian.PutUint64(page[8:], uint64(lsn))
+	binary.LittleEndian.PutUint32(page[16:], uint32(length))
+	binary.LittleEndian.PutUint32(page[20:], uint32(cont))
+	binary.LittleEndian.PutUint32(page[4:], crc32.Checksum(page[8:pageHeaderSize+length], castagnoli))
+}
+
+// checkPage validates page, read from position lsn, and returns its payload
+// and continuation length.
+func checkPage(page []byte, lsn LSN) (payload []byte, cont int, err error) {
+	if binary.LittleEndian.Uint32(page[0:]) != pageMagic {
+		return nil, 0, &PageError{lsn, ErrBadMagic}
+	}
+	length := int(binary.LittleEndian.Uint32(page[16:]))
+	if length > len(page)-pageHeaderSize {
+		return nil, 0, &PageError{lsn, ErrBadLength}
+	}
+	if crc32.Checksum(page[8:pageHeaderSize+length], castagnoli) != binary.LittleEndian.Uint32(page[4:]) {
+		return nil, 0, &PageError{lsn, ErrChecksum}
+	}
+	if LSN(binary.LittleEndian.Uint64(page[8:])) != lsn {
+		return nil, 0, &PageError{lsn, ErrLSNMismatch}
+	}
+	cont = int(binary.LittleEndian.Uint32(page[20:]))
+	return page[pageHeaderSize : pageHeaderSize+length], cont, nil
+}
+
+// scanner reads records from a log, validating every page, and stops at the
+// first record that is not completely backed by valid pages.
+type scanner struct {
+	r        io.ReaderAt
+	size     int64
+	pageSize int
+
+	page    []byte
+	pageLSN LSN    // position of page
+	payload []byte // valid payload of page, nil before the first page
+	off     int    // read position in payload
+	aligned bool   // positioned on a record boundary at least once
+	buf     []byte // reassembly buffer for the current record
+
+	end LSN   // position just after the last valid record
+	err error // why scanning stopped
+}
+
+// newScanner starts reading at the page at start. If that page begins in the
+// middle of a record (after old segments were deleted), the continuation is
+// skipped.
+func newScanner(r io.ReaderAt, size int64, pageSize int, start LSN) *scanner {
+	return &scanner{
+		r:        r,
+		size:     size,
+		pageSize: pageSize,
+		page:     make([]byte, pageSize),
+		pageLSN:  start,
+		end:      start,
+	}
+}
+
+// next returns the next record; the slice is valid until the following call.
+// When no further valid record exists it returns the reason scanning stopped:
+// io.EOF when the log ends cleanly (end of file, or a never-written page on a
+// record boundary), io.ErrUnexpectedEOF when the last record is cut off by
+// the end of the log, or a *PageError / ErrContinuity for damaged pages.
+func (s *scanner) next() ([]byte, LSN, error) {
+	if s.err != nil {
+		return nil, 0, s.err
+	}
+
+	// Move to a record header. A header never spans pages: the writer closes
+	// a page early when fewer than recordHeaderSize bytes are left.
+record:
+	for s.payload == nil || len(s.payload)-s.off < recordHeaderSize {
+		if s.payload != nil {
+			s.pageLSN += LSN(s.pageSize)
+		}
+		if !s.loadPage(false) {
+			return nil, 0, s.err
+		}
+		c := s.cont()
+		switch {
+		case c == 0:
+		case s.aligned:
+			s.err = &PageError{s.pageLSN, ErrContinuity}
+			return nil, 0, s.err
+		case c >= len(s.payload):
+			s.off = len(s.payload) // whole page continues a record from before start
+			s.end = s.pageLSN + pageHeaderSize + LSN(s.off)
+			continue
+		default:
+			s.off = c
+			s.end = s.pageLSN + pageHeaderSize + LSN(s.off)
+		}
+		s.aligned = true
+	}
+
+	lsn := s.pageLSN + pageHeaderSize + LSN(s.off)
+	n := int(binary.LittleEndian.Uint32(s.payload[s.off:]))
+	s.off += recordHeaderSize
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	s.buf = s.buf[:n]
+
+	for dst := s.buf; ; {
+		k := copy(dst, s.payload[s.off:])
+		s.off += k
+		dst = dst[k:]
+		if len(dst) == 0 {
+			break
+		}
+		// the record continues: only a full page may be followed by a continuation
+		if len(s.payload) < s.pageSize-pageHeaderSize {
+			s.err = &PageError{s.pageLSN, ErrContinuity}
+			return nil, 0, s.err
+		}
+		s.pageLSN += LSN(s.pageSize)
+		if !s.loadPage(true) {
+			return nil, 0, s.err
+		}
+		if s.cont() == 0 {
+			goto record // written after recovery dropped this record
+		}
+		if s.cont() != len(dst) {
+			s.err = &PageError{s.pageLSN, ErrContinuity}
+			return nil, 0, s.err
+		}
+	}
+
+	s.end = s.pageLSN + pageHeaderSize + LSN(s.off)
+	return s.buf, lsn, nil
+}
+
+// stoppedAtEnd reports whether err, where a scanner stopped, marks the end of
+// the valid log (a clean end, a cut-off record or a damaged page) rather than
+// a failure to read it. Only then may the log be trimmed at the scanner's end.
+func stoppedAtEnd(err error) bool {
+	var pe *PageError
+	return err == io.EOF || err == io.ErrUnexpectedEOF || errors.As(err, &pe)
+}
+
+func (s *scanner) cont() int {
+	return int(binary.LittleEndian.Uint32(s.page[20:]))
+}
+
+// loadPage reads and validates the page at pageLSN. midRecord tells whether a
+// record is waiting for this page, which turns a clean end into a cut record.
+func (s *scanner) loadPage(midRecord bool) bool {
+	s.payload = nil
+	if int64(s.pageLSN)+int64(s.pageSize) > s.size {
+		s.err = io.EOF
+	} else if _, err := s.r.ReadAt(s.page, int64(s.pageLSN)); err != nil {
+		s.err = err
+	} else if payload, _, err := checkPage(s.page, s.pageLSN); err != nil {
+		s.err = err
+		if isZero(s.page) {
+			s.err = io.EOF // never written
+		}
+	} else {
+		s.payload, s.off = payload, 0
+		return true
+	}
+	if midRecord && s.err == io.EOF {
+		s.err = io.ErrUnexpectedEOF
+	}
+	return false
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+)
+
+// Reader replays a log after a restart. It validates every page and stops at
+// the first record that is not completely backed by valid pages: everything
+// after it was never acknowledged, or is damaged.
+//
+//	r, _ := wal.OpenReader(dir, opts)
+//	for {
+//		data, lsn, err := r.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+//	r.Truncate() // drop the invalid tail so appends continue after End
+//	r.Close()
+type Reader struct {
+	fs       directio.FS
+	dir      string
+	pageSize int
+	segs     []segment
+	r        *segmentReader
+	sc       *scanner
+}
+
+// OpenReader opens the segments in dir for replay, oldest first. Only
+// opts.Mode, opts.PageSize and opts.FS are used; the page size must match the
+// one the log was written with. opts.Mode need not match the writer's: Direct
+// falls back to buffered reads where the filesystem refuses O_DIRECT.
+func OpenReader(dir string, opts Options) (*Reader, error) {
+	if opts.PageSize == 0 {
+		opts.PageSize = directio.BlockSize
+	}
+	if opts.FS == nil {
+		opts.FS = directio.OS
+	}
+	segs, err := listSegments(opts.FS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	r, err := openSegmentReader(opts.FS, segs, opts.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	return &Reader{
+		fs:       opts.FS,
+		dir:      dir,
+		pageSize: opts.PageSize,
+		segs:     segs,
+		r:        r,
+		sc:       newScanner(r, r.size(), opts.PageSize, r.start()),
+	}, nil
+}
+
+// Next returns the next record and its LSN. The slice is valid until the next
+// call. It returns io.EOF after the last valid record, whether the log ended
+// cleanly or at damage; Err tells which. A failed read is returned as is: the
+// rest of the log may be fine, so it is not the end.
+func (r *Reader) Next() ([]byte, LSN, error) {
+	data, lsn, err := r.sc.next()
+	if err != nil {
+		if !stoppedAtEnd(err) {
+			return nil, 0, fmt.Errorf("wal: %w", err)
+		}
+		return nil, 0, io.EOF
+	}
+	return data, lsn, nil
+}
+
+// End is the position just after the last record returned by Next.
+func (r *Reader) End() LSN { return r.sc.end }
+
+// Err reports why replay stopped before the end of the log: a cut-off last
+// record (io.ErrUnexpectedEOF), a damaged page (*PageError), or the error of a
+// failed read. It is nil while records remain and after a clean end.
+func (r *Reader) Err() error {
+	if r.sc.err == io.EOF {
+		return nil
+	}
+	return r.sc.err
+}
+
+// Truncate drops everything after End, once Next has returned io.EOF: later
+// segments are deleted and the rest of the segment holding End is reset to
+// zeros. The page holding End stays as written: rewriting it could tear
+// acknowledged records, so the next Open starts on a fresh page. Open does the
+// same on its own; Truncate is for callers that replay first. After a failed
+// read it refuses and leaves the log alone.
+func (r *Reader) Truncate() error {
+	if r.sc.err == nil {
+		return errors.New("wal: Truncate before the end of the log")
+	}
+	if !stoppedAtEnd(r.sc.err) {
+		return fmt.Errorf("wal: not truncating after a read error: %w", r.sc.err)
+	}
+	if _, _, err := trimLog(r.fs, r.dir, r.segs, r.sc.end, r.pageSize); err != nil {
+		return fmt.Errorf("wal: truncate: %w", err)
+	}
+	return nil
+}
+
+func (r *Reader) Close() error { return r.r.Close() }
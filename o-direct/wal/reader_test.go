@@ -0,0 +1,219 @@
+//go:build linux
+
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"os"
+	"syscall"
+	"testing"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+	"github.com/creotiv/go-hiload/o-direct/crashfs"
+)
+
+func readAll(t *testing.T, dir string) ([]record, *Reader) {
+	t.Helper()
+	return readAllOpts(t, dir, Options{})
+}
+
+func readAllOpts(t *testing.T, dir string, opts Options) ([]record, *Reader) {
+	t.Helper()
+	r, err := OpenReader(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []record
+	for {
+		data, lsn, err := r.Next()
+		if err == io.EOF {
+			return out, r
+		}
+		out = append(out, record{lsn, bytes.Clone(data)})
+	}
+}
+
+// TestReaderRecoversFromRandomDamage flips a byte at a random offset of a log,
+// recovers it and checks replay stops right before the first record touching
+// the damaged page, and that appends after Truncate are replayed too.
+func TestReaderRecoversFromRandomDamage(t *testing.T) {
+	want, log := writeTestLog(t)
+	const page = 4096
+
+	// end of every record in the undamaged log
+	ends := make([]LSN, len(want))
+	sc := newScanner(bytes.NewReader(log), int64(len(log)), page, 0)
+	for i := range ends {
+		if _, _, err := sc.next(); err != nil {
+			t.Fatal(err)
+		}
+		ends[i] = sc.end
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 200 {
+		off := rng.IntN(len(log))
+		damaged := bytes.Clone(log)
+		damaged[off] ^= byte(1 + rng.IntN(255))
+		dir := t.TempDir()
+		writeLog(t, dir, damaged)
+
+		// padding after the payload is not covered by the checksum
+		pg := off / page
+		keep := len(want)
+		if off%page < pageHeaderSize+int(binary.LittleEndian.Uint32(log[pg*page+16:])) {
+			keep = 0
+			for keep < len(want) && ends[keep] <= LSN(pg*page) {
+				keep++
+			}
+		}
+		var end LSN
+		if keep > 0 {
+			end = ends[keep-1]
+		}
+
+		got, r := readAll(t, dir)
+		if len(got) != keep || r.End() != end {
+			t.Fatalf("byte %d damaged: replayed %d records up to %d, want %d up to %d (%v)",
+				off, len(got), r.End(), keep, end, r.Err())
+		}
+		for i := range got {
+			if got[i].lsn != want[i].lsn || !bytes.Equal(got[i].data, want[i].data) {
+				t.Fatalf("byte %d damaged: record %d differs", off, i)
+			}
+		}
+		if keep < len(want) && r.Err() == nil {
+			t.Fatalf("byte %d damaged: replay lost records without an error", off)
+		}
+		if err := r.Truncate(); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+
+		w := openTest(t, dir, Buffered)
+		after := []byte("after recovery")
+		lsn, err := w.Append(after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, r = readAll(t, dir)
+		r.Close()
+		if len(got) != keep+1 || got[keep].lsn != lsn || !bytes.Equal(got[keep].data, after) || r.Err() != nil {
+			t.Fatalf("byte %d damaged: after recovery replayed %d records (%v), want %d", off, len(got), r.Err(), keep+1)
+		}
+	}
+}
+
+func TestReaderTruncateBeforeEnd(t *testing.T) {
+	dir := t.TempDir()
+	w := openTest(t, dir, Buffered)
+	w.Append([]byte("x"))
+	w.Close()
+	r, err := OpenReader(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Truncate() == nil {
+		t.Fatal("Truncate before the end of the log succeeded")
+	}
+}
+
+// TestReaderReadErrorIsNotTheEnd checks a failed read surfaces from Next and
+// Err and that Truncate then leaves the log alone.
+func TestReaderReadErrorIsNotTheEnd(t *testing.T) {
+	fsys := crashfs.New(crashSector)
+	opts := Options{Mode: Buffered, SegmentSize: 2 * 4096, FS: fsys}
+	w, err := Open("wal", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if _, err := w.Append(bytes.Repeat([]byte{byte(i)}, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := fsys.List("wal")
+
+	r, err := OpenReader("wal", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys.FailReads(syscall.EIO)
+	if _, _, err := r.Next(); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Next: %v, want EIO", err)
+	}
+	if !errors.Is(r.Err(), syscall.EIO) {
+		t.Fatalf("Err: %v, want EIO", r.Err())
+	}
+	fsys.FailReads(nil)
+	if err := r.Truncate(); err == nil {
+		t.Fatal("Truncate after a read error succeeded")
+	}
+	r.Close()
+
+	if after, _ := fsys.List("wal"); len(after) != len(names) {
+		t.Fatalf("segments %v after a refused Truncate, want %v", after, names)
+	}
+	r, err = OpenReader("wal", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	n := 0
+	for {
+		if _, _, err := r.Next(); err != nil {
+			if err != io.EOF || r.Err() != nil {
+				t.Fatalf("replay: %v, %v", err, r.Err())
+			}
+			break
+		}
+		n++
+	}
+	if n != 20 {
+		t.Fatalf("replayed %d records, want 20", n)
+	}
+}
+
+// noDirectFS refuses O_DIRECT like tmpfs before 6.6 and some overlayfs setups.
+type noDirectFS struct{ directio.FS }
+
+func (fsys noDirectFS) OpenFile(name string, create, direct bool) (directio.File, error) {
+	if direct {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EINVAL}
+	}
+	return fsys.FS.OpenFile(name, create, direct)
+}
+
+// TestReaderFallsBackToBuffered replays a Buffered log with the zero Options,
+// whose Mode is Direct, where O_DIRECT is refused.
+func TestReaderFallsBackToBuffered(t *testing.T) {
+	fsys := noDirectFS{crashfs.New(crashSector)}
+	w, err := Open("wal", Options{Mode: Buffered, FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if _, err := w.Append([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, r := readAllOpts(t, "wal", Options{FS: fsys})
+	r.Close()
+	if len(got) != 3 || r.Err() != nil {
+		t.Fatalf("replayed %d records (%v), want 3", len(got), r.Err())
+	}
+}
@@ -0,0 +1,399 @@
+package wal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+)
+
+// The log is a sequence of segment files named after the LSN of their first
+// byte, so an LSN maps to a segment and an offset in it. Segments are
+// preallocated to their full size when created; the end of the log is found by
+// scanning, not from the file size. Pages never cross segments (the segment
+// size is a multiple of the page size) but records do, like they cross pages.
+const (
+	segmentExt         = ".wal"
+	defaultSegmentSize = 64 << 20
+)
+
+func segmentName(start LSN) string { return fmt.Sprintf("%020d%s", start, segmentExt) }
+
+type segment struct {
+	start LSN
+	size  int64
+	path  string
+}
+
+func (s segment) end() LSN { return s.start + LSN(s.size) }
+
+// listSegments returns the segments in dir ordered by LSN.
+func listSegments(fsys directio.FS, dir string) ([]segment, error) {
+	names, err := fsys.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []segment
+	for _, name := range names {
+		num, ok := strings.CutSuffix(name, segmentExt)
+		if !ok {
+			continue
+		}
+		start, err := strconv.ParseUint(num, 10, 64)
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		f, err := fsys.OpenFile(path, false, false)
+		if err != nil {
+			return nil, err
+		}
+		size, err := f.Size()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, segment{LSN(start), size, path})
+	}
+	slices.SortFunc(segs, func(a, b segment) int { return cmp.Compare(a.start, b.start) })
+	return segs, nil
+}
+
+// createSegment creates and preallocates a segment, then makes its directory
+// entry durable.
+func createSegment(fsys directio.FS, dir string, start LSN, size int64) (segment, error) {
+	seg := segment{start, size, filepath.Join(dir, segmentName(start))}
+	f, err := fsys.OpenFile(seg.path, true, false)
+	if err != nil {
+		return seg, err
+	}
+	err = f.Allocate(size)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fsys.SyncDir(dir)
+	}
+	return seg, err
+}
+
+// ErrMissingSegment is returned when reading an LSN between two segments:
+// segments are contiguous, so a gap means a file was lost, not that the log
+// ends there.
+var ErrMissingSegment = errors.New("wal: missing segment")
+
+// segmentReader reads the segments as one address space of LSNs. Past the
+// last segment it reads io.EOF; in a gap between segments, ErrMissingSegment.
+//
+// In Direct mode the segments are opened with O_DIRECT and read through a
+// directio.AlignedReader with readahead, so replay does not pull the whole log
+// into the page cache and reads 1 MiB at a time however small the pages are.
+// A filesystem that refuses O_DIRECT (EINVAL) is read buffered instead: the
+// pages are the same either way, and a reader does not care how they were written.
+type segmentReader struct {
+	segs    []segment
+	files   []directio.File
+	readers []io.ReaderAt
+	last    int // segment of the previous read, whose chunks are released on moving on
+}
+
+func openSegmentReader(fsys directio.FS, segs []segment, mode Mode) (*segmentReader, error) {
+	r := &segmentReader{segs: segs}
+	for _, s := range segs {
+		direct := mode == Direct
+		f, err := fsys.OpenFile(s.path, false, direct)
+		if direct && errors.Is(err, syscall.EINVAL) {
+			direct = false
+			f, err = fsys.OpenFile(s.path, false, false)
+		}
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, f)
+		var ra io.ReaderAt = f
+		if direct {
+			ar, err := directio.NewAlignedReader(f, directio.ReaderOptions{Readahead: true})
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			ra = ar
+		}
+		r.readers = append(r.readers, ra)
+	}
+	return r, nil
+}
+
+// size is the LSN just past the last segment.
+func (r *segmentReader) size() int64 {
+	if len(r.segs) == 0 {
+		return 0
+	}
+	return int64(r.segs[len(r.segs)-1].end())
+}
+
+// start is the LSN of the first segment.
+func (r *segmentReader) start() LSN {
+	if len(r.segs) == 0 {
+		return 0
+	}
+	return r.segs[0].start
+}
+
+func (r *segmentReader) ReadAt(p []byte, off int64) (int, error) {
+	done := 0
+	for done < len(p) {
+		pos := LSN(off) + LSN(done)
+		i, ok := slices.BinarySearchFunc(r.segs, pos, func(s segment, pos LSN) int {
+			switch {
+			case s.end() <= pos:
+				return -1
+			case s.start > pos:
+				return 1
+			}
+			return 0
+		})
+		if !ok {
+			if int64(pos) >= r.size() {
+				return done, io.EOF
+			}
+			return done, fmt.Errorf("%w at %d", ErrMissingSegment, pos)
+		}
+		if i != r.last {
+			r.release(r.last)
+			r.last = i
+		}
+		s := r.segs[i]
+		n, err := r.readers[i].ReadAt(p[done:min(len(p), done+int(s.end()-pos))], int64(pos-s.start))
+		done += n
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// release frees the read buffers of segment i.
+func (r *segmentReader) release(i int) {
+	if i < len(r.readers) {
+		if c, ok := r.readers[i].(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+func (r *segmentReader) Close() error {
+	r.release(r.last)
+	var err error
+	for _, f := range r.files {
+		err = errors.Join(err, f.Close())
+	}
+	return err
+}
+
+// trimLog makes end the end of the log: segments starting at or after the
+// page boundary after end are deleted and the rest of the segment holding it
+// is reset to preallocated zeros, so nothing written before a crash can be
+// read back once new pages follow. It returns the remaining segments and the
+// LSN new pages start at.
+func trimLog(fsys directio.FS, dir string, segs []segment, end LSN, pageSize int) ([]segment, LSN, error) {
+	ps := LSN(pageSize)
+	cut := (end + ps - 1) / ps * ps
+	keep := len(segs)
+	for keep > 0 && segs[keep-1].start >= cut {
+		keep--
+	}
+	// newest first, so a crash in between leaves no gap
+	for i := len(segs) - 1; i >= keep; i-- {
+		if err := fsys.Remove(segs[i].path); err != nil {
+			return nil, 0, err
+		}
+	}
+	if keep < len(segs) {
+		if err := fsys.SyncDir(dir); err != nil {
+			return nil, 0, err
+		}
+	}
+	segs = segs[:keep]
+	if keep == 0 || segs[keep-1].end() <= cut {
+		return segs, cut, nil
+	}
+
+	s := segs[keep-1]
+	f, err := fsys.OpenFile(s.path, false, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = f.Truncate(int64(cut - s.start))
+	if err == nil {
+		err = f.Allocate(s.size)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return segs, cut, err
+}
+
+// segmentWriter writes pages at their LSN, opening and creating segments as
+// the log grows. Segments written since the last Sync stay open so Sync can
+// fdatasync them; afterwards only the last one is kept open.
+type segmentWriter struct {
+	mu      sync.Mutex // guards segs against TruncateBefore
+	fs      directio.FS
+	dir     string
+	mode    Mode
+	size    int64 // size of new segments
+	segs    []segment
+	files   map[LSN]directio.File // open segments by start
+	written []LSN                 // segments written since the last Sync
+}
+
+func (w *segmentWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	done := 0
+	for done < len(p) {
+		pos := LSN(off) + LSN(done)
+		s, f, err := w.segmentAt(pos)
+		if err != nil {
+			return done, err
+		}
+		n, err := f.WriteAt(p[done:min(len(p), done+int(s.end()-pos))], int64(pos-s.start))
+		done += n
+		if err != nil {
+			return done, err
+		}
+		if !slices.Contains(w.written, s.start) {
+			w.written = append(w.written, s.start)
+		}
+	}
+	return done, nil
+}
+
+// segmentAt returns the segment holding pos, creating the next one when pos
+// is the end of the log.
+func (w *segmentWriter) segmentAt(pos LSN) (segment, directio.File, error) {
+	var s segment
+	if n := len(w.segs); n > 0 && w.segs[n-1].start <= pos && pos < w.segs[n-1].end() {
+		s = w.segs[n-1]
+	} else if n == 0 || w.segs[n-1].end() == pos {
+		var err error
+		if s, err = createSegment(w.fs, w.dir, pos, w.size); err != nil {
+			return s, nil, fmt.Errorf("create segment: %w", err)
+		}
+		w.segs = append(w.segs, s)
+	} else {
+		return s, nil, fmt.Errorf("write at %d outside the log", pos)
+	}
+
+	if f, ok := w.files[s.start]; ok {
+		return s, f, nil
+	}
+	f, err := w.fs.OpenFile(s.path, false, w.mode == Direct)
+	if err != nil {
+		return s, nil, err
+	}
+	w.files[s.start] = f
+	return s, f, nil
+}
+
+// Sync fdatasyncs every segment written since the last call and closes the
+// ones that are full.
+func (w *segmentWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	last := w.segs[len(w.segs)-1].start
+	for len(w.written) > 0 {
+		start := w.written[0]
+		f := w.files[start]
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		if start != last {
+			delete(w.files, start)
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		w.written = w.written[1:]
+	}
+	return nil
+}
+
+// removeBefore deletes whole segments that end at or before lsn, keeping the
+// last segment and any segment not yet synced.
+func (w *segmentWriter) removeBefore(lsn LSN) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for n < len(w.segs)-1 && w.segs[n].end() <= lsn && !slices.Contains(w.written, w.segs[n].start) {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	for _, s := range w.segs[:n] {
+		if f, ok := w.files[s.start]; ok {
+			f.Close()
+			delete(w.files, s.start)
+		}
+		if err := w.fs.Remove(s.path); err != nil {
+			return err
+		}
+	}
+	w.segs = slices.Delete(w.segs, 0, n)
+	return w.fs.SyncDir(w.dir)
+}
+
+func (w *segmentWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	for start, f := range w.files {
+		err = errors.Join(err, f.Close())
+		delete(w.files, start)
+	}
+	return err
+}
+
+// recoverLog finds the end of the log in dir by scanning every segment, then
+// trims whatever follows it. It returns the segments and the LSN of the next
+// page to write. If scanning stops at a failed read or a missing segment
+// rather than at the end of the valid log, nothing is trimmed and the error is
+// returned: what follows may hold acknowledged records.
+func recoverLog(fsys directio.FS, dir string, pageSize int, mode Mode) ([]segment, LSN, error) {
+	segs, err := listSegments(fsys, dir)
+	if err != nil || len(segs) == 0 {
+		return nil, 0, err
+	}
+	r, err := openSegmentReader(fsys, segs, mode)
+	if err != nil {
+		return nil, 0, err
+	}
+	sc := newScanner(r, r.size(), pageSize, r.start())
+	for {
+		if _, _, err := sc.next(); err != nil {
+			break
+		}
+	}
+	r.Close()
+	if !stoppedAtEnd(sc.err) {
+		return nil, 0, sc.err
+	}
+	return trimLog(fsys, dir, segs, sc.end, pageSize)
+}
@@ -0,0 +1,171 @@
+//go:build linux
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"syscall"
+	"testing"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+	"github.com/creotiv/go-hiload/o-direct/crashfs"
+)
+
+func TestSegmentRotationAndTruncateBefore(t *testing.T) {
+	dir := t.TempDir()
+	const segSize = 4 * 4096
+	w := openTestOpts(t, dir, Options{Mode: Buffered, SegmentSize: segSize})
+
+	var want []record
+	for i := range 40 {
+		data := bytes.Repeat([]byte{byte(i)}, 1500+i*41) // some records cross segments
+		lsn, err := w.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, record{lsn, data})
+		if i%5 == 4 {
+			if err := w.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs, err := listSegments(directio.OS, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) < 5 {
+		t.Fatalf("%d segments, want rotation into several", len(segs))
+	}
+	for i, s := range segs {
+		if s.start != LSN(i*segSize) || s.size != segSize {
+			t.Fatalf("segment %d: start %d size %d, want %d preallocated to %d", i, s.start, s.size, i*segSize, segSize)
+		}
+	}
+
+	// a checkpoint at record 20 makes the segments before it unnecessary
+	cp := want[20].lsn
+	if err := w.TruncateBefore(cp); err != nil {
+		t.Fatal(err)
+	}
+	segs, _ = listSegments(directio.OS, dir)
+	if segs[0].start > cp || segs[0].end() <= cp {
+		t.Fatalf("first segment after TruncateBefore(%d) starts at %d", cp, segs[0].start)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replay starts in the middle of a record and resumes at the next one
+	got, r := readAll(t, dir)
+	r.Close()
+	if r.Err() != nil {
+		t.Fatalf("replay stopped with %v", r.Err())
+	}
+	first := 0
+	for first < len(want) && want[first].lsn < segs[0].start {
+		first++
+	}
+	if len(got) != len(want)-first {
+		t.Fatalf("replayed %d records, want %d", len(got), len(want)-first)
+	}
+	for i, r := range got {
+		if w := want[first+i]; r.lsn != w.lsn || !bytes.Equal(r.data, w.data) {
+			t.Fatalf("record %d differs", i)
+		}
+	}
+
+	// reopening continues after the last record instead of at the end of the
+	// preallocated segment
+	w = openTestOpts(t, dir, Options{Mode: Buffered, SegmentSize: segSize})
+	lsn, err := w.Append([]byte("after reopen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if last := want[len(want)-1]; lsn >= last.lsn+2*4096+LSN(len(last.data)) {
+		t.Fatalf("append after reopen at %d, last record at %d", lsn, last.lsn)
+	}
+	got, r = readAll(t, dir)
+	r.Close()
+	if len(got) != len(want)-first+1 || got[len(got)-1].lsn != lsn {
+		t.Fatalf("record appended after reopen not replayed")
+	}
+}
+
+// writeCrashfsLog writes records across several small segments on crashfs
+// and returns the segment names.
+func writeCrashfsLog(t *testing.T, fsys *crashfs.FS, opts Options) []string {
+	t.Helper()
+	w, err := Open("wal", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if _, err := w.Append(bytes.Repeat([]byte{byte(i)}, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := fsys.List("wal")
+	if len(names) < 3 {
+		t.Fatalf("%d segments, want several", len(names))
+	}
+	return names
+}
+
+// TestOpenReadErrorKeepsSegments checks that a read failing during recovery
+// fails Open instead of being taken for the end of the log and trimming it.
+func TestOpenReadErrorKeepsSegments(t *testing.T) {
+	fsys := crashfs.New(crashSector)
+	opts := Options{Mode: Buffered, SegmentSize: 2 * 4096, FS: fsys}
+	names := writeCrashfsLog(t, fsys, opts)
+
+	fsys.FailReads(syscall.EIO)
+	if w, err := Open("wal", opts); !errors.Is(err, syscall.EIO) {
+		if err == nil {
+			w.Close()
+		}
+		t.Fatalf("Open with failing reads: %v, want EIO", err)
+	}
+	fsys.FailReads(nil)
+	if after, _ := fsys.List("wal"); !slices.Equal(after, names) {
+		t.Fatalf("segments %v after a failed Open, want %v", after, names)
+	}
+
+	got, r := readAllOpts(t, "wal", opts)
+	r.Close()
+	if len(got) != 20 || r.Err() != nil {
+		t.Fatalf("replayed %d records (%v), want 20", len(got), r.Err())
+	}
+}
+
+// TestOpenMissingSegmentKeepsSegments checks that a hole in the segment
+// sequence fails Open rather than trimming everything after it.
+func TestOpenMissingSegmentKeepsSegments(t *testing.T) {
+	fsys := crashfs.New(crashSector)
+	opts := Options{Mode: Buffered, SegmentSize: 2 * 4096, FS: fsys}
+	names := writeCrashfsLog(t, fsys, opts)
+
+	if err := fsys.Remove("wal/" + names[1]); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := Open("wal", opts); !errors.Is(err, ErrMissingSegment) {
+		if err == nil {
+			w.Close()
+		}
+		t.Fatalf("Open with a missing segment: %v, want ErrMissingSegment", err)
+	}
+	want := slices.Delete(slices.Clone(names), 1, 2)
+	if after, _ := fsys.List("wal"); !slices.Equal(after, want) {
+		t.Fatalf("segments %v after a failed Open, want %v", after, want)
+	}
+}
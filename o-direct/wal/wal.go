@@ -0,0 +1,488 @@
+// Package wal is a write-ahead log built on the o-direct benchmarks: records are
+// packed into 4 KiB-aligned pages and written with O_DIRECT (or buffered I/O as
+// a fallback), and made durable with fdatasync.
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+)
+
+// LSN (log sequence number) is the byte position of a record in the log,
+// counted from the start of the first page.
+type LSN uint64
+
+// Mode selects how pages reach the disk.
+type Mode int
+
+const (
+	// Direct writes aligned pages with O_DIRECT, bypassing the page cache.
+	Direct Mode = iota
+	// Buffered writes through the page cache; durability still comes from fdatasync.
+	// Use it where O_DIRECT is rejected (tmpfs, some overlay filesystems).
+	Buffered
+)
+
+func (m Mode) String() string {
+	if m == Buffered {
+		return "buffered"
+	}
+	return "direct"
+}
+
+type Options struct {
+	Mode Mode
+	// PageSize is the unit of every write. Must be a multiple of directio.BlockSize.
+	// Defaults to directio.BlockSize.
+	PageSize int
+	// SegmentSize is the size of each segment file, a multiple of PageSize.
+	// Segments are preallocated with fallocate when created. Defaults to 64 MiB.
+	SegmentSize int64
+
+	// GroupCommit makes Append durable: it returns only after its record was
+	// written and fdatasync'ed. A background flusher gathers the records of all
+	// concurrent Append calls into one aligned write plus one fdatasync, and
+	// wakes every waiter of that batch at once.
+	GroupCommit bool
+	// MaxBatchBytes is the size of one batch write, rounded up to whole pages.
+	// A batch is flushed as soon as it is full. Defaults to 256 KiB.
+	MaxBatchBytes int
+	// MaxWait is how long the flusher lets a batch collect records after the
+	// first one arrived. 0 flushes as soon as the previous flush is done, which
+	// already batches everything that arrived during that fdatasync.
+	MaxWait time.Duration
+
+	// FS holds the segment files. Defaults to directio.OS; crash tests use
+	// crashfs.
+	FS directio.FS
+}
+
+const (
+	recordHeaderSize = 4 // little-endian uint32 payload length
+
+	defaultMaxBatchBytes = 256 * 1024
+)
+
+var ErrClosed = errors.New("wal: closed")
+
+// WAL appends records to a log of segment files (see segment.go).
+//
+// Records are a 4-byte length followed by the payload, packed back to back
+// into the payload area of pages (see page.go for the page format) and
+// spanning pages when needed. Pages are filled in an aligned batch buffer and
+// only ever written whole, one write per batch. Sync seals the page being
+// filled, writes the batch and starts the next record on a fresh page, so a
+// synced page is never rewritten: rewriting it in place could tear records that
+// were already acknowledged.
+type WAL struct {
+	mu   sync.Mutex
+	cond *sync.Cond // broadcast when a flush completes or the batch buffers swap
+	f    *segmentWriter
+	opts Options
+
+	buf   []byte // aligned batch being filled: whole pages, the last one partial
+	spare []byte // second batch buffer; nil while the flusher is writing it
+	base  int64  // LSN of buf
+	page  int    // index in buf of the page being filled
+	used  int    // payload bytes used in that page
+	cont  int    // continuation length for that page's header
+	left  int    // bytes of the record being appended not yet copied
+
+	appending bool // an appender is copying a record (it may wait for room midway)
+	stalled   bool // ... and did wait, so others may be waiting for it
+
+	tail    LSN   // end of the last appended record
+	durable LSN   // everything before this is written and synced
+	err     error // sticky: after a failed write or sync nothing is acknowledged
+	closed  bool
+
+	// group commit flusher
+	kick chan struct{} // records are pending
+	full chan struct{} // the batch buffer is full
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens or creates the log in dir. It scans the log to find its end and
+// drops anything after the last valid record (see Reader), so new records go
+// on the page after it.
+func Open(dir string, opts Options) (*WAL, error) {
+	if opts.PageSize == 0 {
+		opts.PageSize = directio.BlockSize
+	}
+	if opts.PageSize%directio.BlockSize != 0 {
+		return nil, fmt.Errorf("wal: page size %d is not a multiple of %d", opts.PageSize, directio.BlockSize)
+	}
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.SegmentSize <= 0 || opts.SegmentSize%int64(opts.PageSize) != 0 {
+		return nil, fmt.Errorf("wal: segment size %d is not a multiple of the page size", opts.SegmentSize)
+	}
+	if opts.MaxBatchBytes <= 0 {
+		opts.MaxBatchBytes = defaultMaxBatchBytes
+	}
+	pages := (opts.MaxBatchBytes + opts.PageSize - 1) / opts.PageSize
+	opts.MaxBatchBytes = pages * opts.PageSize
+	if opts.FS == nil {
+		opts.FS = directio.OS
+	}
+	if err := opts.FS.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+
+	segs, base, err := recoverLog(opts.FS, dir, opts.PageSize, opts.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("wal: recover: %w", err)
+	}
+	f := &segmentWriter{fs: opts.FS, dir: dir, mode: opts.Mode, size: opts.SegmentSize, segs: segs, files: map[LSN]directio.File{}}
+	// open the segment now, so an unusable mode fails here rather than on the first write
+	if _, _, err := f.segmentAt(base); err != nil {
+		return nil, fmt.Errorf("wal: open %s: %w", opts.Mode, err)
+	}
+
+	w := &WAL{
+		f:     f,
+		opts:  opts,
+		buf:   directio.Aligned(opts.MaxBatchBytes),
+		spare: directio.Aligned(opts.MaxBatchBytes),
+		base:  int64(base),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	w.tail, w.durable = LSN(w.base), LSN(w.base)
+	if opts.GroupCommit {
+		w.kick = make(chan struct{}, 1)
+		w.full = make(chan struct{}, 1)
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.flusher()
+	}
+	return w, nil
+}
+
+// Append adds a record and returns its LSN. Without GroupCommit the record is
+// durable only after a later Sync returns; with it, Append returns once the
+// record is durable.
+func (w *WAL) Append(data []byte) (LSN, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if !w.opts.GroupCommit {
+		return w.appendLocked(data)
+	}
+
+	// Wait for room, and for an appender that ran out of room halfway
+	// through its record to finish it: records are copied one at a time.
+	for (w.appending || w.page*w.opts.PageSize == len(w.buf)) && w.err == nil && !w.closed {
+		signal(w.full)
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, ErrClosed
+	}
+	w.appending = true
+	lsn, err := w.appendLocked(data)
+	w.appending = false
+	if w.stalled {
+		w.stalled = false
+		w.cond.Broadcast()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	end := w.tail
+	signal(w.kick)
+	for w.durable < end && w.err == nil && !w.closed {
+		w.cond.Wait()
+	}
+	switch {
+	case w.durable >= end:
+		return lsn, nil
+	case w.err != nil:
+		return 0, w.err
+	default:
+		return 0, ErrClosed
+	}
+}
+
+// appendLocked copies one record into the batch buffer.
+func (w *WAL) appendLocked(data []byte) (LSN, error) {
+	// record headers never span pages
+	if w.payloadCap()-w.used < recordHeaderSize {
+		if err := w.nextPage(); err != nil {
+			return 0, err
+		}
+	}
+	lsn := w.pos()
+	binary.LittleEndian.PutUint32(w.cur()[pageHeaderSize+w.used:], uint32(len(data)))
+	w.used += recordHeaderSize
+
+	w.left = len(data)
+	for {
+		n := copy(w.cur()[pageHeaderSize+w.used:], data[len(data)-w.left:])
+		w.used += n
+		w.left -= n
+		if w.left == 0 {
+			break
+		}
+		if err := w.nextPage(); err != nil {
+			return 0, err
+		}
+	}
+	w.tail = w.pos()
+	if w.used == w.payloadCap() {
+		if err := w.nextPage(); err != nil {
+			return 0, err
+		}
+	}
+	return lsn, nil
+}
+
+func (w *WAL) payloadCap() int { return w.opts.PageSize - pageHeaderSize }
+
+// cur is the page being filled.
+func (w *WAL) cur() []byte {
+	return w.buf[w.page*w.opts.PageSize : (w.page+1)*w.opts.PageSize]
+}
+
+// pos is the LSN of the next free payload byte.
+func (w *WAL) pos() LSN {
+	return LSN(w.base) + LSN(w.page*w.opts.PageSize) + pageHeaderSize + LSN(w.used)
+}
+
+func (w *WAL) pending() bool { return w.page > 0 || w.used > 0 }
+
+func (w *WAL) pendingBytes() int { return w.page*w.opts.PageSize + w.used }
+
+// nextPage seals the page being filled and moves to the next one, which
+// continues with whatever is left of the record being appended. When the batch
+// buffer is full it is written out (or, with group commit, handed to the flusher).
+func (w *WAL) nextPage() error {
+	sealPage(w.cur(), LSN(w.base)+LSN(w.page*w.opts.PageSize), w.used, w.cont)
+	w.page++
+	w.used = 0
+	w.cont = w.left
+	if w.page*w.opts.PageSize < len(w.buf) {
+		return nil
+	}
+
+	if !w.opts.GroupCommit {
+		return w.writeBatch()
+	}
+	// wait for the flusher to swap in the spare buffer
+	w.stalled = true
+	for w.page*w.opts.PageSize == len(w.buf) && w.err == nil && !w.closed {
+		signal(w.full)
+		w.cond.Wait()
+	}
+	if w.err == nil && w.closed {
+		return ErrClosed
+	}
+	return w.err
+}
+
+// sealTail seals a partly filled last page so the batch ends on a page boundary.
+func (w *WAL) sealTail() {
+	if w.used > 0 {
+		sealPage(w.cur(), LSN(w.base)+LSN(w.page*w.opts.PageSize), w.used, w.cont)
+		w.page++
+		w.used, w.cont = 0, 0
+	}
+}
+
+// writeBatch writes every sealed page with a single write (no group commit).
+func (w *WAL) writeBatch() error {
+	n := w.page * w.opts.PageSize
+	if n == 0 {
+		return nil
+	}
+	if _, err := w.f.WriteAt(w.buf[:n], w.base); err != nil {
+		w.err = fmt.Errorf("wal: write %d bytes at %d: %w", n, w.base, err)
+		return w.err
+	}
+	clear(w.buf[:n])
+	w.base += int64(n)
+	w.page = 0
+	return nil
+}
+
+// Sync makes every record appended so far durable.
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.opts.GroupCommit {
+		// Append already waited for durability; just wait out anything in flight
+		end := w.tail
+		for w.durable < end && w.err == nil && !w.closed {
+			signal(w.kick)
+			w.cond.Wait()
+		}
+		switch {
+		case w.durable >= end:
+			return nil
+		case w.err != nil:
+			return w.err
+		default:
+			return ErrClosed
+		}
+	}
+	return w.sync()
+}
+
+func (w *WAL) sync() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.sealTail()
+	if err := w.writeBatch(); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.err = fmt.Errorf("wal: fdatasync: %w", err)
+		return w.err
+	}
+	w.durable = w.tail
+	return nil
+}
+
+// --- Section: Group commit ---
+
+func (w *WAL) flusher() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.kick:
+		case <-w.full: // a record larger than the free room waits for the swap before it can kick
+			w.flush()
+			continue
+		case <-w.stop:
+			return
+		}
+		if w.opts.MaxWait > 0 {
+			t := time.NewTimer(w.opts.MaxWait)
+			select {
+			case <-w.full:
+			case <-t.C:
+			case <-w.stop:
+			}
+			t.Stop()
+		} else {
+			// let appenders that are already runnable join this batch
+			runtime.Gosched()
+		}
+		w.flush()
+	}
+}
+
+// flush swaps the batch buffers under the lock, so appenders keep filling the
+// other one, then writes and syncs the batch without holding the lock.
+func (w *WAL) flush() {
+	w.mu.Lock()
+	select {
+	case <-w.full:
+	default:
+	}
+	if w.err != nil || !w.pending() {
+		w.mu.Unlock()
+		return
+	}
+	w.sealTail()
+	n := w.page * w.opts.PageSize
+	batch, off := w.buf[:n], w.base
+	w.buf, w.spare = w.spare, nil
+	w.base += int64(n)
+	w.page = 0
+	w.cond.Broadcast() // appenders waiting for room can continue in the new buffer
+	w.mu.Unlock()
+
+	_, err := w.f.WriteAt(batch, off)
+	if err == nil {
+		err = w.f.Sync()
+	}
+	clear(batch)
+
+	w.mu.Lock()
+	w.spare = batch[:w.opts.MaxBatchBytes]
+	if err != nil {
+		w.err = fmt.Errorf("wal: group commit at %d: %w", off, err)
+	} else {
+		w.durable = LSN(off) + LSN(n)
+	}
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// signal does a non-blocking send on a 1-buffered channel.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// TruncateBefore deletes the segments that hold only records before lsn, once
+// a checkpoint made them unnecessary. The segment being written is kept.
+func (w *WAL) TruncateBefore(lsn LSN) error {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if err := w.f.removeBefore(lsn); err != nil {
+		return fmt.Errorf("wal: truncate: %w", err)
+	}
+	return nil
+}
+
+// Close makes pending records durable and closes the segments.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	if !w.opts.GroupCommit {
+		w.closed = true
+		err := w.sync()
+		w.mu.Unlock()
+		if cerr := w.f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	w.flush() // the flusher is gone; flush what is left on this goroutine
+
+	w.mu.Lock()
+	w.closed = true
+	err := w.err
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
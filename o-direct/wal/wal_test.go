@@ -0,0 +1,475 @@
+//go:build linux
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	directio "github.com/creotiv/go-hiload/o-direct"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	recordSize  = 128
+	commitEvery = 64 // same group commit frequency as the o-direct benchmarks
+
+	testSegmentSize = 64 * 1024 // small segments so tests rotate
+)
+
+func openTest(tb testing.TB, dir string, mode Mode) *WAL {
+	tb.Helper()
+	return openTestOpts(tb, dir, Options{Mode: mode, SegmentSize: testSegmentSize})
+}
+
+func openTestOpts(tb testing.TB, dir string, opts Options) *WAL {
+	tb.Helper()
+	w, err := Open(dir, opts)
+	if opts.Mode == Direct && errors.Is(err, unix.EINVAL) {
+		tb.Skipf("O_DIRECT not supported in %s", dir)
+	}
+	if err != nil {
+		tb.Fatalf("open: %v", err)
+	}
+	return w
+}
+
+type record struct {
+	lsn  LSN
+	data []byte
+}
+
+// readLog concatenates the segments in dir, which must start at LSN 0.
+func readLog(t *testing.T, dir string) []byte {
+	t.Helper()
+	segs, err := listSegments(directio.OS, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log []byte
+	for _, s := range segs {
+		if s.start != LSN(len(log)) {
+			t.Fatalf("segment %s does not follow the previous one", s.path)
+		}
+		b, err := os.ReadFile(s.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log = append(log, b...)
+	}
+	return log
+}
+
+// writeLog splits log into segments of testSegmentSize in dir.
+func writeLog(t *testing.T, dir string, log []byte) {
+	t.Helper()
+	for off := 0; off < len(log); off += testSegmentSize {
+		path := filepath.Join(dir, segmentName(LSN(off)))
+		if err := os.WriteFile(path, log[off:min(len(log), off+testSegmentSize)], 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scanLog reads every valid record of the log and returns why scanning stopped.
+func scanLog(t *testing.T, dir string) ([]record, *scanner) {
+	t.Helper()
+	log := readLog(t, dir)
+	sc := newScanner(bytes.NewReader(log), int64(len(log)), 4096, 0)
+	var out []record
+	for {
+		data, lsn, err := sc.next()
+		if err != nil {
+			return out, sc
+		}
+		out = append(out, record{lsn, bytes.Clone(data)})
+	}
+}
+
+func testAppendSyncReopen(t *testing.T, mode Mode) {
+	dir := t.TempDir()
+	w := openTest(t, dir, mode)
+
+	var want []record
+	appendRec := func(w *WAL, size int, fill byte) {
+		data := bytes.Repeat([]byte{fill}, size)
+		lsn, err := w.Append(data)
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		want = append(want, record{lsn, data})
+	}
+
+	for i := 0; i < 100; i++ {
+		appendRec(w, recordSize, byte(i+1))
+	}
+	appendRec(w, 3*4096+17, 0xee) // spans several pages
+	appendRec(w, 0, 0)            // empty records are fine
+	if err := w.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	appendRec(w, 10, 0xaa) // starts on a fresh page after Sync
+	if want[len(want)-1].lsn%4096 != pageHeaderSize {
+		t.Fatalf("record after Sync at LSN %d, want page aligned", want[len(want)-1].lsn)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := w.Append([]byte("x")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("append after close: %v, want ErrClosed", err)
+	}
+
+	w = openTest(t, dir, mode)
+	appendRec(w, 20, 0xbb)
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	got, sc := scanLog(t, dir)
+	if sc.err != io.EOF {
+		t.Fatalf("scan stopped with %v, want io.EOF", sc.err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].lsn != want[i].lsn || !bytes.Equal(got[i].data, want[i].data) {
+			t.Fatalf("record %d: got lsn %d len %d, want lsn %d len %d",
+				i, got[i].lsn, len(got[i].data), want[i].lsn, len(want[i].data))
+		}
+	}
+}
+
+func TestAppendSyncReopenDirect(t *testing.T)   { testAppendSyncReopen(t, Direct) }
+func TestAppendSyncReopenBuffered(t *testing.T) { testAppendSyncReopen(t, Buffered) }
+
+func TestPageSizeMustBeAligned(t *testing.T) {
+	if _, err := Open(t.TempDir(), Options{PageSize: 1000}); err == nil {
+		t.Fatal("Open accepted an unaligned page size")
+	}
+}
+
+// writeTestLog writes records of varying sizes (some spanning pages) in buffered
+// mode and returns them with the log contents.
+func writeTestLog(t *testing.T) ([]record, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	w := openTest(t, dir, Buffered)
+	var want []record
+	for i := 0; i < 60; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, 37*i+1)
+		lsn, err := w.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, record{lsn, data})
+		if i%17 == 16 {
+			if err := w.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return want, readLog(t, dir)
+}
+
+// TestDamagedPageStopsScan damages one page in the ways a crash can and checks
+// the scan returns exactly the records that end before that page.
+func TestDamagedPageStopsScan(t *testing.T) {
+	want, log := writeTestLog(t)
+	const page = 4096
+	const victim = 3 // damaged page index
+	damages := map[string]struct {
+		damage func(log []byte)
+		err    error
+	}{
+		// second sector of the page still holds old data after power loss
+		"torn": {func(log []byte) {
+			copy(log[victim*page+512:victim*page+1024], bytes.Repeat([]byte{0x5a}, 512))
+		}, ErrChecksum},
+		// page left over from an earlier use of the file
+		"stale":  {func(log []byte) { copy(log[victim*page:(victim+1)*page], log[0:page]) }, ErrLSNMismatch},
+		"zeroed": {func(log []byte) { clear(log[victim*page : (victim+1)*page]) }, nil},
+	}
+
+	for name, tc := range damages {
+		t.Run(name, func(t *testing.T) {
+			damaged := bytes.Clone(log)
+			tc.damage(damaged)
+			sc := newScanner(bytes.NewReader(damaged), int64(len(damaged)), page, 0)
+
+			var got []record
+			for {
+				data, lsn, err := sc.next()
+				if err != nil {
+					break
+				}
+				got = append(got, record{lsn, bytes.Clone(data)})
+			}
+			if tc.err != nil && !errors.Is(sc.err, tc.err) {
+				t.Errorf("scan stopped with %v, want %v", sc.err, tc.err)
+			}
+			if tc.err == nil && sc.err != io.EOF && sc.err != io.ErrUnexpectedEOF {
+				t.Errorf("scan of a never-written page stopped with %v, want an end of log", sc.err)
+			}
+
+			// every record that ends before the damaged page survives, nothing after it
+			var expect []record
+			for _, r := range want {
+				if int(r.lsn)+recordHeaderSize+len(r.data) > victim*page {
+					break
+				}
+				expect = append(expect, r)
+			}
+			if len(got) != len(expect) {
+				t.Fatalf("got %d records, want %d", len(got), len(expect))
+			}
+			for i := range expect {
+				if got[i].lsn != expect[i].lsn || !bytes.Equal(got[i].data, expect[i].data) {
+					t.Fatalf("record %d differs", i)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	for _, mode := range []Mode{Direct, Buffered} {
+		t.Run(mode.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			// small batches so records span batches and appenders wait for buffer swaps
+			w := openTestOpts(t, dir, Options{Mode: mode, GroupCommit: true, MaxBatchBytes: 2 * 4096, SegmentSize: testSegmentSize, MaxWait: 100 * time.Microsecond})
+
+			const writers, perWriter = 16, 50
+			var mu sync.Mutex
+			acked := map[LSN][]byte{}
+			var wg sync.WaitGroup
+			for g := range writers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range perWriter {
+						data := bytes.Repeat([]byte{byte(g*perWriter + i)}, 100+(g*perWriter+i)*37%3000)
+						lsn, err := w.Append(data)
+						if err != nil {
+							t.Errorf("append: %v", err)
+							return
+						}
+						mu.Lock()
+						acked[lsn] = data
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			// every acknowledged record is on disk before Close
+			got, sc := scanLog(t, dir)
+			if !errors.Is(sc.err, io.EOF) {
+				t.Fatalf("scan stopped with %v", sc.err)
+			}
+			if len(got) != writers*perWriter {
+				t.Fatalf("scanned %d records, want %d", len(got), writers*perWriter)
+			}
+			for _, r := range got {
+				if !bytes.Equal(r.data, acked[r.lsn]) {
+					t.Fatalf("record at %d does not match the acknowledged one", r.lsn)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if _, err := w.Append(nil); !errors.Is(err, ErrClosed) {
+				t.Fatalf("append after close: %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+// A record appended after Close's final flush is never flushed; a Sync waiting
+// on it must return once Close marks the log closed.
+func TestGroupCommitSyncUnblocksOnClose(t *testing.T) {
+	w := openTestOpts(t, t.TempDir(), Options{Mode: Buffered, GroupCommit: true})
+	defer w.f.Close()
+
+	// Close's first half: the flusher is gone and the last batch is flushed
+	close(w.stop)
+	<-w.done
+	w.flush()
+
+	w.mu.Lock()
+	w.tail = w.durable + 1 // a late append
+	w.mu.Unlock()
+	select {
+	case <-w.kick:
+	default:
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Sync() }()
+	<-w.kick // Sync is in the wait loop and holds the lock until cond.Wait
+
+	// Close's second half
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("sync: %v, want ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync still waiting after close")
+	}
+}
+
+// --- Section: Benchmarks ---
+
+// appendLog is what the append+sync benchmarks drive: a WAL or an MmapLog.
+type appendLog interface {
+	Append([]byte) (LSN, error)
+	Sync() error
+	Close() error
+}
+
+// benchAppendSync appends b.N records with a Sync every commitEvery records
+// and reports the Sync latency percentiles.
+func benchAppendSync(b *testing.B, l appendLog) {
+	defer l.Close()
+	data := make([]byte, recordSize)
+	lat := make([]time.Duration, 0, b.N/commitEvery)
+	b.SetBytes(recordSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := l.Append(data); err != nil {
+			b.Fatalf("append: %v", err)
+		}
+		if i%commitEvery == commitEvery-1 {
+			start := time.Now()
+			if err := l.Sync(); err != nil {
+				b.Fatalf("sync: %v", err)
+			}
+			lat = append(lat, time.Since(start))
+		}
+	}
+	b.StopTimer()
+
+	if len(lat) > 0 {
+		b.ReportMetric(float64(percentile(lat, 0.50).Microseconds()), "p50-sync-µs")
+		b.ReportMetric(float64(percentile(lat, 0.99).Microseconds()), "p99-sync-µs")
+	}
+}
+
+// benchDir is where the WAL benchmarks put their logs, like -dir in the
+// o-direct benchmarks:
+//
+//	go test -bench WAL ./wal -args -dir=/mnt/nvme
+//	DIRECTIO_DIR=/mnt/nvme go test -bench WAL ./wal
+var benchDir = flag.String("dir", os.Getenv("DIRECTIO_DIR"), "directory for the benchmark logs ($DIRECTIO_DIR, default $TMPDIR)")
+
+// benchLogDir returns a fresh directory under -dir, removed when b ends.
+func benchLogDir(b *testing.B) string {
+	b.Helper()
+	if *benchDir == "" {
+		return b.TempDir()
+	}
+	dir, err := os.MkdirTemp(*benchDir, "wal-bench-")
+	if err != nil {
+		b.Fatalf("-dir: %v", err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func BenchmarkWALDirectAppendSync(b *testing.B) {
+	benchAppendSync(b, openTestOpts(b, benchLogDir(b), Options{Mode: Direct}))
+}
+
+func BenchmarkWALBufferedAppendSync(b *testing.B) {
+	benchAppendSync(b, openTestOpts(b, benchLogDir(b), Options{Mode: Buffered}))
+}
+
+func BenchmarkWALMmapAppendSync(b *testing.B) {
+	l, err := OpenMmap(benchLogDir(b), Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchAppendSync(b, l)
+}
+
+// benchGroupCommit runs b.N durable appends spread over the given number of
+// writers and reports throughput and ack latency percentiles.
+func benchGroupCommit(b *testing.B, mode Mode, writers int) {
+	w := openTestOpts(b, benchLogDir(b), Options{Mode: mode, GroupCommit: true})
+	defer w.Close()
+	data := make([]byte, recordSize)
+	b.SetBytes(recordSize)
+
+	lat := make([][]time.Duration, writers)
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for g := range writers {
+		n := b.N / writers
+		if g < b.N%writers {
+			n++
+		}
+		lat[g] = make([]time.Duration, 0, n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				start := time.Now()
+				if _, err := w.Append(data); err != nil {
+					b.Errorf("append: %v", err)
+					return
+				}
+				lat[g] = append(lat[g], time.Since(start))
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+
+	all := slices.Concat(lat...)
+	if len(all) == 0 {
+		return
+	}
+	b.ReportMetric(float64(len(all))/b.Elapsed().Seconds(), "records/s")
+	b.ReportMetric(float64(percentile(all, 0.50).Microseconds()), "p50-µs")
+	b.ReportMetric(float64(percentile(all, 0.99).Microseconds()), "p99-µs")
+}
+
+// percentile returns the p-th percentile of lat, sorting it in place; the
+// same as in the o-direct benchmarks.
+func percentile(lat []time.Duration, p float64) time.Duration {
+	slices.Sort(lat)
+	return lat[int(float64(len(lat)-1)*p)]
+}
+
+var groupWriters = []int{1, 4, 16, 64, 256}
+
+func BenchmarkWALDirectGroupCommit(b *testing.B) {
+	for _, n := range groupWriters {
+		b.Run(fmt.Sprintf("writers=%d", n), func(b *testing.B) { benchGroupCommit(b, Direct, n) })
+	}
+}
+
+func BenchmarkWALBufferedGroupCommit(b *testing.B) {
+	for _, n := range groupWriters {
+		b.Run(fmt.Sprintf("writers=%d", n), func(b *testing.B) { benchGroupCommit(b, Buffered, n) })
+	}
+}
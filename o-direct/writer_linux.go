@@ -0,0 +1,171 @@
+//go:build linux
+
+package directio
+
+import (
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// SyncWriter is the commit path of a log: it writes a batch of aligned blocks
+// back to back starting at off and returns once they are durable.
+type SyncWriter interface {
+	WriteSync(bufs [][]byte, off int64) error
+	Close() error
+}
+
+// PwriteWriter issues one pwrite per buffer and then fdatasync: two kinds of
+// syscalls and len(bufs)+1 round trips per commit.
+type PwriteWriter struct{ FD int }
+
+func (w PwriteWriter) WriteSync(bufs [][]byte, off int64) error {
+	for _, b := range bufs {
+		n, err := unix.Pwrite(w.FD, b, off)
+		if err != nil {
+			return err
+		}
+		if n != len(b) {
+			return io.ErrShortWrite
+		}
+		off += int64(n)
+	}
+	return unix.Fdatasync(w.FD)
+}
+
+// Close does nothing: the caller owns the descriptor.
+func (w PwriteWriter) Close() error { return nil }
+
+// iovMax is IOV_MAX: the most buffers one pwritev2 call takes.
+const iovMax = 1024
+
+// PwritevWriter writes the whole batch with one pwritev2 call on an iovec of
+// the aligned blocks, so group commit does not have to copy records into one
+// contiguous buffer. Flags are per-write RWF_ flags:
+//
+//   - RWF_DSYNC makes each write durable by itself (a FUA write or a cache
+//     flush), so no separate fdatasync is issued.
+//   - RWF_NOWAIT fails with EAGAIN instead of blocking, e.g. when the write
+//     needs block allocation. Part of the batch may already be written; the
+//     caller can retry the commit without the flag from another goroutine.
+type PwritevWriter struct {
+	FD    int
+	Flags int
+}
+
+func (w PwritevWriter) WriteSync(bufs [][]byte, off int64) error {
+	for len(bufs) > 0 {
+		iov := bufs[:min(len(bufs), iovMax)]
+		n, err := unix.Pwritev2(w.FD, iov, off, w.Flags)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		off += int64(n)
+		for len(bufs) > 0 && n >= len(bufs[0]) {
+			n -= len(bufs[0])
+			bufs = bufs[1:]
+		}
+		if n > 0 { // short write: go on with the rest without touching the caller's slice
+			bufs = append([][]byte{bufs[0][n:]}, bufs[1:]...)
+		}
+	}
+	if w.Flags&unix.RWF_DSYNC != 0 {
+		return nil
+	}
+	return unix.Fdatasync(w.FD)
+}
+
+func (w PwritevWriter) Close() error { return nil }
+
+// NewSyncWriter returns an io_uring writer for fd, or a PwriteWriter when the
+// kernel has no usable io_uring; fallback then says why.
+func NewSyncWriter(fd int) (w SyncWriter, fallback error) {
+	u, err := NewUringWriter(fd, 64)
+	if err != nil {
+		return PwriteWriter{fd}, err
+	}
+	return u, nil
+}
+
+// WriteBehind is a buffered writer that keeps the page cache from piling up
+// dirty data between commits. Once Chunk bytes past the last chunk boundary
+// are written, it starts writeback of the completed chunks with
+// sync_file_range(SYNC_FILE_RANGE_WRITE) and waits for the writeback it
+// started the time before, so at most about two chunks are dirty or in
+// flight. Commit is fdatasync, which then only has the last chunk to write,
+// instead of everything since the previous commit in one burst.
+//
+// sync_file_range makes nothing durable by itself: it neither flushes the
+// drive cache nor writes metadata. Only Commit does.
+type WriteBehind struct {
+	FD int
+	// Chunk is the writeback unit. Defaults to 1 MiB.
+	Chunk int64
+	// Off is where the next Write goes.
+	Off int64
+
+	started int64 // writeback started for everything before this
+	waited  int64 // ... and completed for everything before this
+}
+
+const defaultWriteBehindChunk = 1 << 20
+
+// Write writes p at Off and advances it.
+func (w *WriteBehind) Write(p []byte) (int, error) {
+	if w.Off < w.started { // moved back: forget the writeback state
+		w.started, w.waited = w.Off, w.Off
+	}
+	done := 0
+	for done < len(p) {
+		n, err := unix.Pwrite(w.FD, p[done:], w.Off)
+		if err != nil {
+			return done, err
+		}
+		if n == 0 {
+			return done, io.ErrShortWrite
+		}
+		done += n
+		w.Off += int64(n)
+	}
+
+	chunk := w.Chunk
+	if chunk <= 0 {
+		chunk = defaultWriteBehindChunk
+	}
+	end := w.Off - w.Off%chunk
+	if end-w.started < chunk {
+		return done, nil
+	}
+	if err := unix.SyncFileRange(w.FD, w.started, end-w.started, unix.SYNC_FILE_RANGE_WRITE); err != nil {
+		return done, err
+	}
+	if w.started > w.waited {
+		const wait = unix.SYNC_FILE_RANGE_WAIT_BEFORE | unix.SYNC_FILE_RANGE_WRITE | unix.SYNC_FILE_RANGE_WAIT_AFTER
+		if err := unix.SyncFileRange(w.FD, w.waited, w.started-w.waited, wait); err != nil {
+			return done, err
+		}
+	}
+	w.waited, w.started = w.started, end
+	return done, nil
+}
+
+// Commit makes everything written so far durable.
+func (w *WriteBehind) Commit() error { return unix.Fdatasync(w.FD) }
+
+// WriteSync writes bufs from off and commits, which makes WriteBehind usable
+// wherever a SyncWriter is.
+func (w *WriteBehind) WriteSync(bufs [][]byte, off int64) error {
+	w.Off = off
+	for _, b := range bufs {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return w.Commit()
+}
+
+// Close does nothing: the caller owns the descriptor.
+func (w *WriteBehind) Close() error { return nil }
@@ -0,0 +1,229 @@
+package pointerchasing
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+const (
+	nodeCount   = 1 << 20 // 1M nodes: 32 MB of list nodes, well past L2
+	lookupCount = 1 << 12 // distinct random lookup keys, cycled through
+)
+
+var (
+	sumSink int64
+	valSink int64
+)
+
+func reportPerElem(b *testing.B, elems int) {
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(elems), "ns/elem")
+}
+
+func lookupKeys(n int) []int64 {
+	r := rand.New(rand.NewSource(2))
+	keys := make([]int64, lookupCount)
+	for i := range keys {
+		keys[i] = int64(r.Intn(n)) * 2
+	}
+	return keys
+}
+
+func TestStructuresAgree(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 1000} {
+		wantSum := int64(n) * int64(n-1) / 2
+		order := Shuffled(n, 1)
+		bt := BuildBTree(n)
+
+		sums := map[string][2]int64{}
+		add := func(name string, s int64, c int) { sums[name] = [2]int64{s, int64(c)} }
+		s, c := SumList(BuildList(n, order))
+		add("list", s, c)
+		s, c = SumListPrefetch(BuildList(n, order))
+		add("list-prefetch", s, c)
+		s, c = SumIndexList(BuildIndexList(n, order))
+		add("index", s, c)
+		s, c = SumIndexListPrefetch(BuildIndexList(n, order))
+		add("index-prefetch", s, c)
+		s, c = SumTree(BuildTree(n, order))
+		add("tree", s, c)
+		s, c = SumBTree(bt)
+		add("btree", s, c)
+		for name, got := range sums {
+			if got != [2]int64{wantSum, int64(n)} {
+				t.Errorf("n=%d %s: sum,count = %v, want %d,%d", n, name, got, wantSum, n)
+			}
+		}
+
+		list, idx, tree := BuildList(n, order), BuildIndexList(n, order), BuildTree(n, order)
+		for key := int64(-1); key <= int64(2*n); key++ {
+			wantVal, wantOK := key/2, key >= 0 && key%2 == 0 && key < int64(2*n)
+			if !wantOK {
+				wantVal = 0
+			}
+			check := func(name string, v int64, ok bool) {
+				if v != wantVal || ok != wantOK {
+					t.Fatalf("n=%d %s find(%d) = %d,%v want %d,%v", n, name, key, v, ok, wantVal, wantOK)
+				}
+			}
+			v, ok := FindList(list, key)
+			check("list", v, ok)
+			v, ok = FindIndexList(idx, key)
+			check("index", v, ok)
+			v, ok = FindTree(tree, key)
+			check("tree", v, ok)
+			v, ok = FindBTree(bt, key)
+			check("btree", v, ok)
+		}
+	}
+}
+
+// --- Section: Traversal ---
+
+func BenchmarkListSequential(b *testing.B) {
+	head := BuildList(nodeCount, nil)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumList(head)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkListShuffled(b *testing.B) {
+	head := BuildList(nodeCount, Shuffled(nodeCount, 1))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumList(head)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkListShuffledPrefetch(b *testing.B) {
+	head := BuildList(nodeCount, Shuffled(nodeCount, 1))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumListPrefetch(head)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkIndexListSequential(b *testing.B) {
+	l := BuildIndexList(nodeCount, nil)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumIndexList(l)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkIndexListShuffled(b *testing.B) {
+	l := BuildIndexList(nodeCount, Shuffled(nodeCount, 1))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumIndexList(l)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkIndexListShuffledPrefetch(b *testing.B) {
+	l := BuildIndexList(nodeCount, Shuffled(nodeCount, 1))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumIndexListPrefetch(l)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkTreeTraversal(b *testing.B) {
+	root := BuildTree(nodeCount, Shuffled(nodeCount, 1))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumTree(root)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+func BenchmarkBTreeTraversal(b *testing.B) {
+	t := BuildBTree(nodeCount)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sumSink, _ = SumBTree(t)
+	}
+	reportPerElem(b, b.N*nodeCount)
+}
+
+// --- Section: Lookup ---
+
+// List lookups visit key/2+1 nodes, so ns/elem is comparable with the traversals.
+
+func BenchmarkListLookup(b *testing.B) {
+	head := BuildList(nodeCount, Shuffled(nodeCount, 1))
+	keys := lookupKeys(nodeCount)
+	visited := 0
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		k := keys[i%lookupCount]
+		valSink, _ = FindList(head, k)
+		visited += int(k/2) + 1
+	}
+	reportPerElem(b, visited)
+}
+
+func BenchmarkIndexListLookup(b *testing.B) {
+	l := BuildIndexList(nodeCount, Shuffled(nodeCount, 1))
+	keys := lookupKeys(nodeCount)
+	visited := 0
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		k := keys[i%lookupCount]
+		valSink, _ = FindIndexList(l, k)
+		visited += int(k/2) + 1
+	}
+	reportPerElem(b, visited)
+}
+
+func BenchmarkTreeLookup(b *testing.B) {
+	root := BuildTree(nodeCount, Shuffled(nodeCount, 1))
+	keys := lookupKeys(nodeCount)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		valSink, _ = FindTree(root, keys[i%lookupCount])
+	}
+}
+
+func BenchmarkBTreeLookup(b *testing.B) {
+	t := BuildBTree(nodeCount)
+	keys := lookupKeys(nodeCount)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		valSink, _ = FindBTree(t, keys[i%lookupCount])
+	}
+}
+
+// Binary search over a sorted slice: contiguous, but every probe of the first
+// levels lands on a different cache line.
+func BenchmarkSortedSliceLookup(b *testing.B) {
+	sorted := make([]int64, nodeCount)
+	for i := range sorted {
+		sorted[i] = int64(i) * 2
+	}
+	keys := lookupKeys(nodeCount)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		k := keys[i%lookupCount]
+		valSink = int64(sort.Search(len(sorted), func(j int) bool { return sorted[j] >= k }))
+	}
+}
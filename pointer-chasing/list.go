@@ -0,0 +1,170 @@
+package pointerchasing
+
+import "math/rand"
+
+// prefetchDistance is how many nodes ahead the prefetching traversals touch.
+// Far enough that the miss is resolved by the time the walk gets there, close
+// enough that the line has not been evicted again.
+const prefetchDistance = 8
+
+// --- Section: Pointer-linked list ---
+
+// ListNode is a classic heap-allocated singly linked list node.
+// ahead points prefetchDistance nodes down the list (a "jump pointer"), so the
+// traversal can start the load for a future node without waiting on next.
+type ListNode struct {
+	Key   int64
+	Val   int64
+	next  *ListNode
+	ahead *ListNode
+}
+
+// BuildList allocates n nodes in one slice and links them in the given order.
+// order == nil links them in memory order (best case); a permutation scatters
+// consecutive list nodes across the whole array, like a long-lived list whose
+// nodes were allocated at different times.
+func BuildList(n int, order []int) *ListNode {
+	if n == 0 {
+		return nil
+	}
+	nodes := make([]ListNode, n)
+	if order == nil {
+		order = identity(n)
+	}
+	for pos, idx := range order {
+		nodes[idx].Key = int64(pos) * 2
+		nodes[idx].Val = int64(pos)
+		if pos+1 < n {
+			nodes[idx].next = &nodes[order[pos+1]]
+		}
+		if pos+prefetchDistance < n {
+			nodes[idx].ahead = &nodes[order[pos+prefetchDistance]]
+		}
+	}
+	return &nodes[order[0]]
+}
+
+// SumList walks the list; every step depends on the previous load.
+func SumList(head *ListNode) (sum int64, n int) {
+	for p := head; p != nil; p = p.next {
+		sum += p.Val
+		n++
+	}
+	return sum, n
+}
+
+// SumListPrefetch walks the list and touches the node prefetchDistance ahead,
+// so up to prefetchDistance cache misses are in flight instead of one.
+func SumListPrefetch(head *ListNode) (sum int64, n int) {
+	var touch int64
+	for p := head; p != nil; p = p.next {
+		if a := p.ahead; a != nil {
+			touch += a.Key
+		}
+		sum += p.Val
+		n++
+	}
+	prefetchSink = touch
+	return sum, n
+}
+
+// FindList scans for key; lookup in a list is a traversal that stops early.
+func FindList(head *ListNode, key int64) (int64, bool) {
+	for p := head; p != nil; p = p.next {
+		if p.Key == key {
+			return p.Val, true
+		}
+	}
+	return 0, false
+}
+
+// --- Section: Slice-backed index list ---
+
+// IndexNode is a list node living in a slice, linked by int32 index instead of
+// pointer: half the link size, no GC scanning, same dependent-load chain.
+type IndexNode struct {
+	Key   int64
+	Val   int64
+	next  int32
+	ahead int32
+}
+
+// IndexList is a linked list stored in one slice; -1 terminates.
+type IndexList struct {
+	Nodes []IndexNode
+	Head  int32
+}
+
+// BuildIndexList mirrors BuildList for the slice-backed variant.
+func BuildIndexList(n int, order []int) IndexList {
+	l := IndexList{Nodes: make([]IndexNode, n), Head: -1}
+	if n == 0 {
+		return l
+	}
+	if order == nil {
+		order = identity(n)
+	}
+	for pos, idx := range order {
+		nd := &l.Nodes[idx]
+		nd.Key = int64(pos) * 2
+		nd.Val = int64(pos)
+		nd.next, nd.ahead = -1, -1
+		if pos+1 < n {
+			nd.next = int32(order[pos+1])
+		}
+		if pos+prefetchDistance < n {
+			nd.ahead = int32(order[pos+prefetchDistance])
+		}
+	}
+	l.Head = int32(order[0])
+	return l
+}
+
+func SumIndexList(l IndexList) (sum int64, n int) {
+	nodes := l.Nodes
+	for i := l.Head; i >= 0; i = nodes[i].next {
+		sum += nodes[i].Val
+		n++
+	}
+	return sum, n
+}
+
+func SumIndexListPrefetch(l IndexList) (sum int64, n int) {
+	nodes := l.Nodes
+	var touch int64
+	for i := l.Head; i >= 0; i = nodes[i].next {
+		if a := nodes[i].ahead; a >= 0 {
+			touch += nodes[a].Key
+		}
+		sum += nodes[i].Val
+		n++
+	}
+	prefetchSink = touch
+	return sum, n
+}
+
+func FindIndexList(l IndexList, key int64) (int64, bool) {
+	nodes := l.Nodes
+	for i := l.Head; i >= 0; i = nodes[i].next {
+		if nodes[i].Key == key {
+			return nodes[i].Val, true
+		}
+	}
+	return 0, false
+}
+
+// prefetchSink keeps the touched loads alive; the value itself is meaningless.
+var prefetchSink int64
+
+func identity(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// Shuffled returns a deterministic random permutation of [0, n).
+func Shuffled(n int, seed int64) []int {
+	return rand.New(rand.NewSource(seed)).Perm(n)
+}
@@ -0,0 +1,153 @@
+package pointerchasing
+
+import "math"
+
+// --- Section: Pointer-linked binary search tree ---
+
+// TreeNode is a balanced BST node; a lookup is log2(n) dependent loads, each
+// likely to miss once the tree outgrows the cache.
+type TreeNode struct {
+	Key         int64
+	Val         int64
+	left, right *TreeNode
+}
+
+// BuildTree builds a balanced BST over keys 0, 2, 4, ... 2(n-1). Node storage is
+// handed out in the given order, so with a permutation parent and children end
+// up far apart in memory.
+func BuildTree(n int, order []int) *TreeNode {
+	if n == 0 {
+		return nil
+	}
+	nodes := make([]TreeNode, n)
+	if order == nil {
+		order = identity(n)
+	}
+	next := 0
+	var build func(lo, hi int) *TreeNode
+	build = func(lo, hi int) *TreeNode {
+		if lo >= hi {
+			return nil
+		}
+		mid := (lo + hi) / 2
+		nd := &nodes[order[next]]
+		next++
+		nd.Key, nd.Val = int64(mid)*2, int64(mid)
+		nd.left = build(lo, mid)
+		nd.right = build(mid+1, hi)
+		return nd
+	}
+	return build(0, n)
+}
+
+func FindTree(root *TreeNode, key int64) (int64, bool) {
+	for p := root; p != nil; {
+		switch {
+		case key < p.Key:
+			p = p.left
+		case key > p.Key:
+			p = p.right
+		default:
+			return p.Val, true
+		}
+	}
+	return 0, false
+}
+
+// SumTree walks the tree in order with an explicit stack.
+func SumTree(root *TreeNode) (sum int64, n int) {
+	stack := make([]*TreeNode, 0, 64)
+	for p := root; p != nil || len(stack) > 0; {
+		for p != nil {
+			stack = append(stack, p)
+			p = p.left
+		}
+		p = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		sum += p.Val
+		n++
+		p = p.right
+	}
+	return sum, n
+}
+
+// --- Section: B-tree-like node array ---
+
+// bKeys keys of int64 fill exactly one 64-byte cache line per node.
+const bKeys = 8
+
+// BTree is a static, implicit B-tree: node k's children are k*(bKeys+1)+1+i,
+// so there are no child pointers at all. Each level of a lookup is one cache
+// line, and the tree is log9(n) levels deep instead of log2(n).
+type BTree struct {
+	Keys [][bKeys]int64
+	Vals [][bKeys]int64 // kept apart so the key line is not diluted by values
+	n    int
+}
+
+const bEmpty = math.MaxInt64
+
+// BuildBTree builds the implicit B-tree over keys 0, 2, 4, ... 2(n-1).
+func BuildBTree(n int) BTree {
+	nblocks := (n + bKeys - 1) / bKeys
+	t := BTree{
+		Keys: make([][bKeys]int64, nblocks),
+		Vals: make([][bKeys]int64, nblocks),
+		n:    n,
+	}
+	next := 0
+	var build func(k int)
+	build = func(k int) {
+		if k >= nblocks {
+			return
+		}
+		for i := 0; i < bKeys; i++ {
+			build(bChild(k, i))
+			if next < n {
+				t.Keys[k][i], t.Vals[k][i] = int64(next)*2, int64(next)
+				next++
+			} else {
+				t.Keys[k][i] = bEmpty
+			}
+		}
+		build(bChild(k, bKeys))
+	}
+	build(0)
+	return t
+}
+
+func bChild(k, i int) int { return k*(bKeys+1) + 1 + i }
+
+func FindBTree(t BTree, key int64) (int64, bool) {
+	found, fk, fi := false, 0, 0
+	for k := 0; k < len(t.Keys); {
+		keys := &t.Keys[k]
+		i := 0
+		for i < bKeys && keys[i] < key {
+			i++
+		}
+		if i < bKeys && keys[i] == key {
+			found, fk, fi = true, k, i
+			break
+		}
+		k = bChild(k, i)
+	}
+	if !found {
+		return 0, false
+	}
+	return t.Vals[fk][fi], true
+}
+
+// SumBTree scans node storage front to back: a full traversal of an array-backed
+// structure needs no pointer chasing at all when order does not matter.
+func SumBTree(t BTree) (sum int64, n int) {
+	for k := range t.Keys {
+		for i := 0; i < bKeys; i++ {
+			if t.Keys[k][i] != bEmpty {
+				sum += t.Vals[k][i]
+				n++
+			}
+		}
+	}
+	return sum, n
+}
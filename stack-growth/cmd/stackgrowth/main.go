@@ -0,0 +1,102 @@
+// Command stackgrowth runs sample handlers in many goroutines and prints how far
+// their stacks grew, to spot handlers with pathological stack growth.
+//
+//	go run ./cmd/stackgrowth -n 1024 -warn 65536
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/creotiv/go-hiload/stack-growth"
+)
+
+var sink atomic.Uint64
+
+// The handlers mirror goroutine-stack-vs-heap: a goroutine-local [N]byte buffer
+// lives on the stack, so its size decides how often the stack is copied.
+
+//go:noinline
+func small(int) {
+	sink.Add(1)
+}
+
+//go:noinline
+func buf4k(int) {
+	var buf [4 * 1024]byte
+	touch(buf[:])
+}
+
+//go:noinline
+func buf32k(int) {
+	var buf [32 * 1024]byte
+	touch(buf[:])
+}
+
+// recursive grows with its input: every tenth request recurses 10x deeper.
+func recursive(i int) {
+	depth := 100
+	if i%10 == 0 {
+		depth = 1000
+	}
+	recurse(depth)
+}
+
+//go:noinline
+func recurse(depth int) uint64 {
+	var frame [128]byte
+	frame[depth%len(frame)] = byte(depth)
+	if depth == 0 {
+		return uint64(frame[0])
+	}
+	return recurse(depth-1) + uint64(frame[depth%len(frame)])
+}
+
+//go:noinline
+func touch(buf []byte) {
+	var local uint64
+	for j := 0; j < len(buf); j += 512 {
+		buf[j]++
+		local += uint64(buf[j])
+	}
+	sink.Add(local)
+}
+
+func main() {
+	n := flag.Int("n", 1024, "goroutines per handler")
+	warn := flag.Uint64("warn", 64*1024, "flag handlers whose final stack is at least this many bytes")
+	flag.Parse()
+
+	handlers := []struct {
+		name string
+		fn   func(int)
+	}{
+		{"small", small},
+		{"buf4k", buf4k},
+		{"buf32k", buf32k},
+		{"recursive", func(i int) { recursive(i) }},
+	}
+
+	reports := make([]stackgrowth.Report, 0, len(handlers))
+	for _, h := range handlers {
+		reports = append(reports, stackgrowth.Measure(h.name, *n, h.fn))
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CopiedBytes > reports[j].CopiedBytes })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "handler\tgoroutines\tprofiled\tstart_bytes\tfinal_bytes\tgrowths/g\ttotal_growths\tcopied_bytes\t\t")
+	for _, r := range reports {
+		flagged := ""
+		if r.FinalSize >= *warn {
+			flagged = "<- pathological"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+			r.Handler, r.Goroutines, r.Profiled, r.StartSize, r.FinalSize,
+			r.Growths, r.TotalGrowths(), r.CopiedBytes, flagged)
+	}
+	tw.Flush()
+}
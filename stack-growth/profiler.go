@@ -0,0 +1,142 @@
+package stackgrowth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"runtime/pprof"
+	"strings"
+	"sync"
+)
+
+const (
+	metricStackStart = "/gc/stack/starting-size:bytes"
+	metricStacks     = "/memory/classes/heap/stacks:bytes"
+
+	labelKey = "handler"
+)
+
+// Report describes the stacks of one handler after it ran in many goroutines.
+//
+// runtime/metrics has no per-goroutine stack histogram, so sizes are derived
+// from the growth of /memory/classes/heap/stacks:bytes while all goroutines of
+// the handler are parked after returning from it (stacks only shrink during
+// GC, and GC is disabled for the measurement). Goroutine stacks start at
+// StartSize and double on every growth, copying the old stack each time.
+type Report struct {
+	Handler    string
+	Goroutines int
+	StartSize  uint64 // /gc/stack/starting-size:bytes
+	// FinalSize is the average stack per goroutine, rounded to the power of two the
+	// runtime allocates. Handlers whose depth depends on input report the average;
+	// measure each input class as its own handler to tell them apart.
+	FinalSize uint64
+	// Growths is log2(FinalSize/StartSize): the growth events of a goroutine with the
+	// average stack. With mixed depths no single goroutine need match it.
+	Growths int
+	// CopiedBytes estimates total bytes copied by all growths of all goroutines.
+	// Each growth copies at most the old stack: StartSize+2*StartSize+... = FinalSize-StartSize.
+	CopiedBytes uint64
+	// Profiled is the number of goroutines carrying this handler's pprof label in
+	// the goroutine profile taken during measurement. Anything below Goroutines
+	// means some exited early and the sizes are diluted.
+	Profiled int
+}
+
+// TotalGrowths estimates growth events across all goroutines from the average.
+func (r Report) TotalGrowths() int { return r.Growths * r.Goroutines }
+
+func (r Report) String() string {
+	return fmt.Sprintf("%s: %d goroutines, stack %d -> %d bytes, %d growths each, ~%d bytes copied",
+		r.Handler, r.Goroutines, r.StartSize, r.FinalSize, r.Growths, r.CopiedBytes)
+}
+
+// Measure runs fn in n goroutines labelled with handler and reports their stack growth.
+// fn receives the goroutine index so workloads can vary their depth with input.
+func Measure(handler string, n int, fn func(i int)) Report {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	runtime.GC()
+
+	samples := []metrics.Sample{{Name: metricStackStart}, {Name: metricStacks}}
+	metrics.Read(samples)
+	start := samples[0].Value.Uint64()
+	before := samples[1].Value.Uint64()
+
+	var ready, done sync.WaitGroup
+	release := make(chan struct{})
+	ready.Add(n)
+	done.Add(n)
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		go pprof.Do(ctx, pprof.Labels(labelKey, handler), func(context.Context) {
+			defer done.Done()
+			fn(i)
+			ready.Done()
+			<-release
+		})
+	}
+	ready.Wait()
+
+	metrics.Read(samples)
+	after := samples[1].Value.Uint64()
+	profiled := countLabelled(handler)
+
+	close(release)
+	done.Wait()
+
+	r := Report{Handler: handler, Goroutines: n, StartSize: start, Profiled: profiled}
+	var perG uint64
+	if after > before && n > 0 {
+		perG = (after - before) / uint64(n)
+	}
+	r.FinalSize = roundPow2(max(perG, start))
+	if start > 0 && r.FinalSize > start {
+		r.Growths = bits.Len64(r.FinalSize/start) - 1
+		r.CopiedBytes = (r.FinalSize - start) * uint64(n)
+	}
+	return r
+}
+
+// countLabelled counts goroutines with the handler label in a debug=1 goroutine profile:
+//
+//	3 @ 0x43a1d6 0x44c2e5 ...
+//	# labels: {"handler":"buf32k"}
+func countLabelled(handler string) int {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return 0
+	}
+	want := fmt.Sprintf("%q:%q", labelKey, handler)
+
+	total, count := 0, 0
+	sc := bufio.NewScanner(&buf)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if n, _, ok := strings.Cut(line, " @ "); ok {
+			count = 0
+			fmt.Sscanf(n, "%d", &count)
+			continue
+		}
+		if labels, ok := strings.CutPrefix(line, "# labels: "); ok && strings.Contains(labels, want) {
+			total += count
+		}
+	}
+	return total
+}
+
+func roundPow2(v uint64) uint64 {
+	if v == 0 {
+		return 0
+	}
+	lo := uint64(1) << (bits.Len64(v) - 1)
+	if 2*(v-lo) < lo {
+		return lo
+	}
+	return lo << 1
+}
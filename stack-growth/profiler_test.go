@@ -0,0 +1,56 @@
+package stackgrowth
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"testing"
+)
+
+var sink atomic.Uint64
+
+//go:noinline
+func bigFrame(int) {
+	var buf [32 * 1024]byte
+	var local uint64
+	for j := 0; j < len(buf); j += 512 {
+		buf[j]++
+		local += uint64(buf[j])
+	}
+	sink.Add(local)
+}
+
+//go:noinline
+func noFrame(int) {}
+
+func TestMeasure(t *testing.T) {
+	const n = 256
+
+	r := Measure("noframe", n, noFrame)
+	if r.Growths != 0 || r.FinalSize != r.StartSize {
+		t.Errorf("noframe: %v, want no growth", r)
+	}
+	if r.Profiled != n {
+		t.Errorf("noframe: profiled %d goroutines, want %d", r.Profiled, n)
+	}
+
+	r = Measure("bigframe", n, bigFrame)
+	// a 32 KB frame plus runtime overhead needs a 64 KB stack
+	if r.FinalSize != 64*1024 {
+		t.Errorf("bigframe: final size %d, want %d", r.FinalSize, 64*1024)
+	}
+	if want := bits.Len64(64*1024/r.StartSize) - 1; r.Growths != want {
+		t.Errorf("bigframe: %d growths, want %d", r.Growths, want)
+	}
+	if r.CopiedBytes != (r.FinalSize-r.StartSize)*n {
+		t.Errorf("bigframe: copied %d bytes", r.CopiedBytes)
+	}
+}
+
+func TestRoundPow2(t *testing.T) {
+	cases := map[uint64]uint64{0: 0, 1: 1, 2048: 2048, 2100: 2048, 3500: 4096, 65000: 65536}
+	for in, want := range cases {
+		if got := roundPow2(in); got != want {
+			t.Errorf("roundPow2(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
@@ -0,0 +1 @@
+go run ./cmd/stackgrowth
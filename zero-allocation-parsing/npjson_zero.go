@@ -1,7 +1,11 @@
 package zeroallocationparsing
 
 import (
-	"strconv"
+	"bytes"
+	"fmt"
+	"math"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 type LogRecord struct {
@@ -13,123 +17,487 @@ type LogRecord struct {
 
 // ParseBatch parses a JSON array of objects with a known schema.
 // No reflection, no maps, no allocation except final strings.
+// Malformed input fails with a *SyntaxError. A null batch is empty and a null
+// element is a zero record, as with encoding/json.
 func ParseBatchCustom(src []byte) ([]LogRecord, error) {
 	var out []LogRecord
+	r := npReader{src: src}
 
-	i := 0
-	n := len(src)
-
-	// skip whitespace until '['
-	for i < n && src[i] != '[' {
-		i++
-	}
-	if i == n {
-		return out[:0], nil
+	r.skipSpace()
+	// like encoding/json, a null batch is an empty one
+	if !r.null() {
+		if err := r.expect('['); err != nil {
+			return nil, err
+		}
+		if err := r.elements(&out); err != nil {
+			return nil, err
+		}
 	}
-	i++ // skip '['
 
-	recordCount := 0
+	r.skipSpace()
+	if r.i < len(src) {
+		return nil, r.errorf("end of input")
+	}
+	return out, nil
+}
 
-	// main loop: find objects {...}
-	for i < n {
-		// find '{'
-		for i < n && src[i] != '{' {
-			if src[i] == ']' {
-				return out[:recordCount], nil
+// elements parses the array elements after '[' up to and including ']'. A
+// null element is a zero record, as encoding/json decodes it.
+func (r *npReader) elements(out *[]LogRecord) error {
+	r.skipSpace()
+	if r.peek() == ']' {
+		r.i++
+		return nil
+	}
+	// main loop: one object per element
+	for {
+		r.skipSpace()
+		*out = append(*out, LogRecord{})
+		if !r.null() {
+			if err := r.expect('{'); err != nil {
+				return err
+			}
+			if err := r.fields(&(*out)[len(*out)-1]); err != nil {
+				return err
 			}
-			i++
 		}
-		if i == n {
-			break
+		r.skipSpace()
+		if r.peek() == ',' {
+			r.i++
+			continue
 		}
-		i++ // skip '{'
+		return r.expect(']')
+	}
+}
+
+// SyntaxError describes malformed input to ParseBatchCustom: where it is and
+// what the parser expected there.
+type SyntaxError struct {
+	Offset   int    // byte offset in the input
+	Line     int    // 1-based
+	Column   int    // 1-based, in bytes
+	Expected string // e.g. "':'", "string", "integer in int64 range"
+	Found    string // the byte at Offset, quoted, or "end of input"
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("npjson: line %d, column %d (offset %d): expected %s, found %s",
+		e.Line, e.Column, e.Offset, e.Expected, e.Found)
+}
+
+// npReader reads JSON at src[i:]. Unescaped strings are built in scratch,
+// which is reused for the whole batch.
+type npReader struct {
+	src     []byte
+	i       int
+	scratch []byte
+}
+
+// errorf returns a *SyntaxError at the current offset.
+func (r *npReader) errorf(expected string) error {
+	return r.errorAt(r.i, expected)
+}
+
+func (r *npReader) errorAt(off int, expected string) error {
+	e := &SyntaxError{Offset: off, Expected: expected, Found: "end of input"}
+	if off < len(r.src) {
+		e.Found = fmt.Sprintf("%q", r.src[off])
+	}
+	before := r.src[:min(off, len(r.src))]
+	e.Line = 1 + bytes.Count(before, []byte{'\n'})
+	e.Column = len(before) - bytes.LastIndexByte(before, '\n')
+	return e
+}
+
+// peek returns the next byte, or 0 at the end of the input.
+func (r *npReader) peek() byte {
+	if r.i < len(r.src) {
+		return r.src[r.i]
+	}
+	return 0
+}
+
+func (r *npReader) skipSpace() {
+	for r.i < len(r.src) && isSpace(r.src[r.i]) {
+		r.i++
+	}
+}
 
-		// ensure out has capacity
-		if recordCount >= len(out) {
-			out = append(out, LogRecord{})
+// expect consumes c or fails.
+func (r *npReader) expect(c byte) error {
+	if r.i == len(r.src) || r.src[r.i] != c {
+		return r.errorf(fmt.Sprintf("%q", c))
+	}
+	r.i++
+	return nil
+}
+
+// fields parses the members of an object, after its '{', into rec.
+func (r *npReader) fields(rec *LogRecord) error {
+	r.skipSpace()
+	if r.peek() == '}' {
+		r.i++
+		return nil
+	}
+	for {
+		r.skipSpace()
+		key, err := r.stringBytes()
+		if err != nil {
+			return err
+		}
+		r.skipSpace()
+		if err := r.expect(':'); err != nil {
+			return err
 		}
-		rec := &out[recordCount]
+		r.skipSpace()
 
-		// parse fields
-		for i < n && src[i] != '}' {
-			// find '"'
-			for i < n && src[i] != '"' {
-				i++
+		// parse value depending on type; null leaves the field as is
+		name := schemaKey(key)
+		switch name {
+		case "ts":
+			if r.null() {
+				break
 			}
-			i++ // skip first quote
+			v, err := r.int64()
+			if err != nil {
+				return err
+			}
+			rec.TS = v
 
-			// key start
-			keyStart := i
-			for i < n && src[i] != '"' {
-				i++
+		case "msg", "lev", "app":
+			if r.null() {
+				break
+			}
+			field := &rec.Msg
+			switch name {
+			case "lev":
+				field = &rec.Lev
+			case "app":
+				field = &rec.App
 			}
-			keyEnd := i
-			i++ // skip closing quote
+			b, err := r.stringBytes()
+			if err != nil {
+				return err
+			}
+			*field = string(b)
 
-			// skip colon
-			for i < n && src[i] != ':' {
-				i++
+		default:
+			// unknown key; its value sits inside the array and the record
+			if err := r.skipValue(2); err != nil {
+				return err
 			}
-			i++ // skip ':'
+		}
+
+		r.skipSpace()
+		if r.peek() == ',' {
+			r.i++
+			continue
+		}
+		return r.expect('}')
+	}
+}
 
-			key := string(src[keyStart:keyEnd])
+// schemaKey returns the LogRecord key that key names, or "". Like
+// encoding/json it matches case-insensitively, so "MSG" and "Ts" count too.
+func schemaKey(key []byte) string {
+	for _, name := range [...]string{"ts", "msg", "lev", "app"} {
+		if bytes.EqualFold(key, []byte(name)) {
+			return name
+		}
+	}
+	return ""
+}
 
-			// parse value depending on type
-			switch key {
-			case "ts":
-				// integer
-				for i < n && (src[i] == ' ' || src[i] == '\n') {
-					i++
-				}
-				valStart := i
-				for i < n && (src[i] >= '0' && src[i] <= '9') {
-					i++
-				}
-				v, _ := strconv.ParseInt(string(src[valStart:i]), 10, 64)
-				rec.TS = v
+// maxDepth bounds the nesting of skipped values, as encoding/json does.
+const maxDepth = 10000
 
-			case "msg", "lev", "app":
-				// string: skip until opening quote
-				for i < n && src[i] != '"' {
-					i++
-				}
-				i++ // skip first "
-				valStart := i
-				for i < n && src[i] != '"' {
-					i++
-				}
-				valEnd := i
-				i++ // skip closing "
-
-				s := string(src[valStart:valEnd])
-
-				switch key {
-				case "msg":
-					rec.Msg = s
-				case "lev":
-					rec.Lev = s
-				case "app":
-					rec.App = s
-				}
-			}
+// skipValue skips the value of an unknown key, validating it: any JSON value,
+// nested objects and arrays included.
+func (r *npReader) skipValue(depth int) error {
+	switch c := r.peek(); {
+	case c == '"':
+		_, err := r.stringBytes()
+		return err
+	case c == '{' || c == '[':
+		if depth == maxDepth {
+			return r.errorf("nesting depth at most 10000")
+		}
+		return r.skipContainer(depth + 1)
+	case c == '-' || '0' <= c && c <= '9':
+		return r.skipNumber()
+	case c == 't':
+		return r.literal("true")
+	case c == 'f':
+		return r.literal("false")
+	case c == 'n':
+		return r.literal("null")
+	}
+	return r.errorf("value")
+}
 
-			// skip until next key or end of object
-			for i < n && src[i] != '"' && src[i] != '}' {
-				i++
+// skipContainer skips an object or an array.
+func (r *npReader) skipContainer(depth int) error {
+	end := byte(']')
+	obj := r.src[r.i] == '{'
+	if obj {
+		end = '}'
+	}
+	r.i++
+	r.skipSpace()
+	if r.peek() == end {
+		r.i++
+		return nil
+	}
+	for {
+		r.skipSpace()
+		if obj {
+			if _, err := r.stringBytes(); err != nil {
+				return err
+			}
+			r.skipSpace()
+			if err := r.expect(':'); err != nil {
+				return err
 			}
+			r.skipSpace()
+		}
+		if err := r.skipValue(depth); err != nil {
+			return err
+		}
+		r.skipSpace()
+		if r.peek() == ',' {
+			r.i++
+			continue
 		}
+		return r.expect(end)
+	}
+}
 
-		// skip '}'
-		if i < n && src[i] == '}' {
-			i++
+// skipNumber skips a number: -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func (r *npReader) skipNumber() error {
+	if r.peek() == '-' {
+		r.i++
+	}
+	switch c := r.peek(); {
+	case c == '0':
+		r.i++
+	case '1' <= c && c <= '9':
+		r.digits()
+	default:
+		return r.errorf("digit")
+	}
+	if r.peek() == '.' {
+		r.i++
+		if !r.digits() {
+			return r.errorf("digit")
+		}
+	}
+	if c := r.peek(); c == 'e' || c == 'E' {
+		r.i++
+		if c := r.peek(); c == '+' || c == '-' {
+			r.i++
+		}
+		if !r.digits() {
+			return r.errorf("digit")
+		}
+	}
+	return nil
+}
+
+// digits skips a run of digits and reports whether there was one.
+func (r *npReader) digits() bool {
+	start := r.i
+	for r.i < len(r.src) && '0' <= r.src[r.i] && r.src[r.i] <= '9' {
+		r.i++
+	}
+	return r.i > start
+}
+
+// literal consumes lit, or fails at the first byte that differs.
+func (r *npReader) literal(lit string) error {
+	for k := 0; k < len(lit); k++ {
+		if r.peek() != lit[k] || r.i == len(r.src) {
+			return r.errorf(fmt.Sprintf("%q", lit))
 		}
-		recordCount++
+		r.i++
+	}
+	return nil
+}
 
-		// skip comma / whitespace
-		for i < n && src[i] != '{' && src[i] != ']' {
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+// null consumes a null literal if one is next.
+func (r *npReader) null() bool {
+	if len(r.src)-r.i >= 4 && string(r.src[r.i:r.i+4]) == "null" {
+		r.i += 4
+		return true
+	}
+	return false
+}
+
+// int64 parses a JSON integer: an optional minus sign and digits without
+// leading zeros. Fractions and exponents are rejected, as encoding/json does
+// for an int64 field.
+func (r *npReader) int64() (int64, error) {
+	src, i := r.src, r.i
+	neg := i < len(src) && src[i] == '-'
+	if neg {
+		i++
+	}
+	start := i
+	var v uint64
+	for ; i < len(src) && src[i] >= '0' && src[i] <= '9'; i++ {
+		d := uint64(src[i] - '0')
+		if v > (math.MaxUint64-d)/10 {
+			return 0, r.errorf("integer in int64 range")
+		}
+		v = v*10 + d
+	}
+	switch {
+	case i == start:
+		return 0, r.errorAt(i, "integer")
+	case i-start > 1 && src[start] == '0':
+		return 0, r.errorAt(start+1, "integer without leading zeros")
+	case i < len(src) && (src[i] == '.' || src[i] == 'e' || src[i] == 'E'):
+		return 0, r.errorAt(i, "integer")
+	case neg && v > 1<<63, !neg && v > math.MaxInt64:
+		return 0, r.errorf("integer in int64 range")
+	}
+	r.i = i
+	if neg {
+		return -int64(v), nil // -1<<63 wraps to itself
+	}
+	return int64(v), nil
+}
+
+// stringBytes reads a string and returns its unescaped bytes: a subslice of
+// src when the string has no escapes, else scratch. Either is valid only until
+// the next call. Decoding matches encoding/json: \uXXXX surrogate pairs are
+// combined, and lone surrogates and invalid UTF-8 become U+FFFD.
+func (r *npReader) stringBytes() ([]byte, error) {
+	src := r.src
+	if r.i >= len(src) || src[r.i] != '"' {
+		return nil, r.errorf("string")
+	}
+	start := r.i + 1
+
+	// fast path: plain ASCII or valid UTF-8 without escapes
+	ascii := true
+	i := start
+	for ; i < len(src); i++ {
+		c := src[i]
+		if c == '"' || c == '\\' || c < 0x20 {
+			break
+		}
+		if c >= utf8.RuneSelf {
+			ascii = false
+		}
+	}
+	if i == len(src) || src[i] < 0x20 {
+		return nil, r.errorAt(i, `'"'`)
+	}
+	if src[i] == '"' && (ascii || utf8.Valid(src[start:i])) {
+		r.i = i + 1
+		return src[start:i], nil
+	}
+
+	// slow path: unescape into scratch
+	buf := append(r.scratch[:0], src[start:i]...)
+	if !ascii {
+		buf = appendValidUTF8(buf[:0], src[start:i])
+	}
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '"':
+			r.i = i + 1
+			r.scratch = buf
+			return buf, nil
+		case c < 0x20:
+			return nil, r.errorAt(i, `'"'`)
+		case c == '\\':
+			if i+1 == len(src) {
+				return nil, r.errorAt(i+1, "escape character")
+			}
+			switch src[i+1] {
+			case '"', '\\', '/':
+				buf = append(buf, src[i+1])
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'u':
+				rr := hex4(src[min(i+2, len(src)):])
+				if rr < 0 {
+					return nil, r.errorAt(i+2, "4 hex digits")
+				}
+				i += 6
+				if utf16.IsSurrogate(rr) {
+					// a valid pair is two escapes; anything else is a lone surrogate
+					if rr2 := hex4(src[min(i+2, len(src)):]); i+1 < len(src) && src[i] == '\\' && src[i+1] == 'u' && rr2 >= 0 {
+						if dec := utf16.DecodeRune(rr, rr2); dec != utf8.RuneError {
+							buf = utf8.AppendRune(buf, dec)
+							i += 6
+							continue
+						}
+					}
+					rr = utf8.RuneError
+				}
+				buf = utf8.AppendRune(buf, rr)
+				continue
+			default:
+				return nil, r.errorAt(i+1, "escape character")
+			}
+			i += 2
+		case c < utf8.RuneSelf:
+			buf = append(buf, c)
 			i++
+		default:
+			rr, size := utf8.DecodeRune(src[i:])
+			buf = utf8.AppendRune(buf, rr) // RuneError for an invalid byte
+			i += size
 		}
 	}
+	return nil, r.errorAt(i, `'"'`)
+}
 
-	return out[:recordCount], nil
+// hex4 decodes four hex digits at the start of b, or returns -1.
+func hex4(b []byte) rune {
+	if len(b) < 4 {
+		return -1
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return -1
+		}
+		r = r<<4 | rune(c)
+	}
+	return r
+}
+
+// appendValidUTF8 appends b with every invalid byte replaced by U+FFFD.
+func appendValidUTF8(dst, b []byte) []byte {
+	for len(b) > 0 {
+		rr, size := utf8.DecodeRune(b)
+		if rr == utf8.RuneError && size == 1 {
+			dst = utf8.AppendRune(dst, rr)
+		} else {
+			dst = append(dst, b[:size]...)
+		}
+		b = b[size:]
+	}
+	return dst
 }
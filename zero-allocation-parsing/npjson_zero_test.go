@@ -0,0 +1,187 @@
+package zeroallocationparsing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// trickyBatches decode the same way with ParseBatchCustom and ParseBatchStd.
+var trickyBatches = []string{
+	`[]`,
+	` [ ] `,
+	`[{"ts":1,"msg":"hello","lev":"info","app":"gateway"}]`,
+	`[{"ts":-42,"msg":"negative"},{"ts":0},{"ts":-0}]`,
+	`[{"ts":9223372036854775807},{"ts":-9223372036854775808}]`,
+	`[ { "ts" : 7 , "msg" : "spaced" } ,
+	  {	"lev":"tab",
+		"app":"newline"} ]`,
+	`[{"msg":"she said \"hi\""}]`,
+	`[{"msg":"back\\slash \/ \b\f\n\r\t end"}]`,
+	`[{"msg":"\"","lev":"\\","app":"\\\""}]`,
+	`[{"msg":"\u0041\u00e9\u4e2d\u20AC"}]`,
+	`[{"msg":"pair \ud83d\ude00 emoji"}]`,
+	`[{"msg":"lone high \ud83d end"},{"msg":"lone low \ude00"},{"msg":"high then A \ud83d\u0041"}]`,
+	`[{"msg":"reversed \ude00\ud83d"}]`,
+	`[{"msg":"raw utf-8: héllo 世界 😀"}]`,
+	"[{\"msg\":\"invalid \xff utf-8 \xc3\"}]",
+	"[{\"msg\":\"invalid \xff with escape \\n\"}]",
+	`[{"msg":"","lev":"","app":""}]`,
+	`[{"msg":null,"ts":null,"lev":"kept"}]`,
+	`[{"ts":5,"ts":6,"msg":"dup","msg":"last wins"}]`,
+	`[{"app":"only app"},{"lev":"only lev"}]`,
+	`[{"m\u0073g":"escaped key"}]`,
+	`[{"MSG":"x","Ts":5},{"Lev":"warn","aPP":"upper"}]`,
+	`[{"msg":"first","MSG":"last wins"}]`,
+	"[{\"m\u017fg\":\"long s folds to s\",\"\u212a\":\"kelvin sign is not a key\"}]",
+	`[{"msg":"}{][,:"}]`,
+	`[{"ctx":{"user":{"id":7,"tags":["a","b"]},"ok":true},"msg":"after ctx"}]`,
+	`[{"a":true,"b":false,"c":null,"ts":3},{"d":[],"e":{},"msg":"empty containers"}]`,
+	`[{"n":-0.5e+10,"m":0,"o":1E-3,"p":12.75,"ts":-1}]`,
+	`[{"s":"brace } quote \" bracket ] comma ,","lev":"warn"}]`,
+	`[{"deep":[[[[{"a":[{"b":"}"}]}]]]],"app":"deep"}]`,
+	`[ { "x" : [ 1 , { "y" : null } ] , "msg" : "spaced" } ]`,
+	`null`,
+	` null `,
+	`[null]`,
+	`[{"msg":"a"},null]`,
+	`[ null , {"msg":"b"} , null ]`,
+}
+
+func toRecords(std []LogRecordStd) []LogRecord {
+	out := make([]LogRecord, len(std))
+	for i, r := range std {
+		out[i] = LogRecord(r)
+	}
+	return out
+}
+
+func TestParseBatchCustomMatchesStd(t *testing.T) {
+	for _, in := range trickyBatches {
+		std, err := ParseBatchStd([]byte(in))
+		if err != nil {
+			t.Fatalf("std rejects %q: %v", in, err)
+		}
+		want := toRecords(std)
+		got, err := ParseBatchCustom([]byte(in))
+		if err != nil {
+			t.Errorf("ParseBatchCustom(%q): %v", in, err)
+			continue
+		}
+		if len(got) != len(want) {
+			t.Errorf("ParseBatchCustom(%q): %d records, want %d", in, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("ParseBatchCustom(%q)[%d] = %+q, want %+q", in, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// badBatches are rejected by both parsers.
+var badBatches = []string{
+	`[{"ts":1.5}]`,
+	`[{"ts":1e3}]`,
+	`[{"ts":-}]`,
+	`[{"ts":01}]`,
+	`[{"ts":9223372036854775808}]`,
+	`[{"ts":-9223372036854775809}]`,
+	`[{"ts":99999999999999999999999}]`,
+	`[{"ts":"5"}]`,
+	`[{"msg":5}]`,
+	`[{"msg":"bad escape \x"}]`,
+	`[{"msg":"short \u12"}]`,
+	`[{"msg":"bad hex \u12G4"}]`,
+	"[{\"msg\":\"raw\ncontrol\"}]",
+	`[{"msg":"unterminated`,
+	`[{"msg" "no colon"}]`,
+	`[{"msg":"a" "lev":"no comma"}]`,
+	`[{"msg":"a"},]`,
+	`[{"msg":"a"}] trailing`,
+	`nul`,
+	`null null`,
+	`[nul]`,
+	`[null,]`,
+	`[nullx]`,
+	`[{"ctx":{"a":}}]`,
+	`[{"ctx":{"a" 1}}]`,
+	`[{"ctx":{"a":1,}}]`,
+	`[{"ctx":[1,]}]`,
+	`[{"ctx":[1 2]}]`,
+	`[{"ctx":{"a":[1}}]`,
+	`[{"x":tru}]`,
+	`[{"x":nul}]`,
+	`[{"x":01}]`,
+	`[{"x":1.}]`,
+	`[{"x":1e}]`,
+	`[{"x":-}]`,
+	`[{"x":+1}]`,
+	`[{"x":"bad \q"}]`,
+	`[{"x":{1:2}}]`,
+	`[{"x":}]`,
+	`[{"msg":"a"}`,
+	`{"msg":"not an array"}`,
+	``,
+}
+
+func TestParseBatchCustomRejectsWhatStdRejects(t *testing.T) {
+	for _, in := range badBatches {
+		if _, err := ParseBatchStd([]byte(in)); err == nil {
+			t.Fatalf("std accepts %q", in)
+		}
+		got, err := ParseBatchCustom([]byte(in))
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("ParseBatchCustom(%q) = %+q, %v; want a *SyntaxError", in, got, err)
+		}
+	}
+}
+
+func TestParseBatchCustomSyntaxError(t *testing.T) {
+	for _, tc := range []struct {
+		in                   string
+		offset, line, column int
+		expected, found      string
+	}{
+		{`[{"msg":"unterminated`, 21, 1, 22, `'"'`, "end of input"},
+		{"[\n {\"ts\":1},\n {\"msg\" \"x\"}]", 21, 3, 9, `':'`, `'"'`},
+		{`[{"ts":12x}]`, 9, 1, 10, `'}'`, `'x'`},
+		{`[{"ts":1.5}]`, 8, 1, 9, "integer", `'.'`},
+		{`[{"ts":-}]`, 8, 1, 9, "integer", `'}'`},
+		{`[{"ts":007}]`, 8, 1, 9, "integer without leading zeros", `'0'`},
+		{`[{"ts":9223372036854775808}]`, 7, 1, 8, "integer in int64 range", `'9'`},
+		{`[{"msg":"a\qb"}]`, 11, 1, 12, "escape character", `'q'`},
+		{`[{"msg":"\u12G4"}]`, 11, 1, 12, "4 hex digits", `'1'`},
+		{`[{"msg":5}]`, 8, 1, 9, "string", `'5'`},
+		{`[{"msg":"a"}] {}`, 14, 1, 15, "end of input", `'{'`},
+		{`[{"msg":"a"},]`, 13, 1, 14, `'{'`, `']'`},
+		{"  \n", 3, 2, 1, `'['`, "end of input"},
+		{`[{"ctx":{"a":[1,}]}]`, 16, 1, 17, "value", `'}'`},
+		{`[{"ctx":tru}]`, 11, 1, 12, `"true"`, `'}'`},
+		{`[{"ctx":1.e5}]`, 10, 1, 11, "digit", `'e'`},
+	} {
+		_, err := ParseBatchCustom([]byte(tc.in))
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("ParseBatchCustom(%q): %v, want a *SyntaxError", tc.in, err)
+			continue
+		}
+		want := SyntaxError{Offset: tc.offset, Line: tc.line, Column: tc.column, Expected: tc.expected, Found: tc.found}
+		if *se != want {
+			t.Errorf("ParseBatchCustom(%q): %+v, want %+v", tc.in, *se, want)
+		}
+	}
+}
+
+func TestParseBatchCustomNestingLimit(t *testing.T) {
+	for _, depth := range []int{9998, 9999} {
+		in := `[{"ctx":` + strings.Repeat("[", depth) + strings.Repeat("]", depth) + `}]`
+		_, stdErr := ParseBatchStd([]byte(in))
+		_, err := ParseBatchCustom([]byte(in))
+		if (err == nil) != (stdErr == nil) {
+			t.Errorf("depth %d: ParseBatchCustom: %v, std: %v", depth, err, stdErr)
+		}
+	}
+}